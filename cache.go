@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+// cacheSet keeps an informer cache per cluster and namespace for the
+// long-running commands, which connect again for every run or request.
+type cacheSet struct {
+	ctx context.Context
+
+	mu     sync.Mutex
+	caches map[string]*restarter.Cache
+}
+
+func newCacheSet(ctx context.Context) *cacheSet {
+	return &cacheSet{ctx: ctx, caches: map[string]*restarter.Cache{}}
+}
+
+// get returns the cache for namespaces on the cluster config points at,
+// starting it on first use: one namespace gets a cache of its own, several
+// share one of the whole cluster.
+func (s *cacheSet) get(config *rest.Config, namespaces []string) (*restarter.Cache, error) {
+	namespace := metav1.NamespaceAll
+	if len(namespaces) == 1 {
+		namespace = namespaces[0]
+	}
+	key := config.Host + "/" + namespace
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.caches[key]; ok {
+		return c, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Starting informer cache", "server", config.Host, "namespace", namespace)
+	c, err := restarter.NewCache(s.ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	s.caches[key] = c
+	return c, nil
+}
@@ -0,0 +1,1261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+// argoCDTimeout bounds each call to the Argo CD API server.
+const argoCDTimeout = 30 * time.Second
+
+// prometheusTimeout bounds each --promql-gate query.
+const prometheusTimeout = 30 * time.Second
+
+type options struct {
+	configFile        string
+	configFlags       *genericclioptions.ConfigFlags
+	context           string
+	contexts          []string
+	fleet             string
+	fleetParallelism  int
+	fleets            map[string]fleetConfig
+	kubeconfig        string
+	target            string
+	parallel          bool
+	selector          string
+	helmReleases      []string
+	fieldSelector     string
+	match             []string
+	patterns          []restarter.NamePattern
+	excludeNamespaces []string
+	exclude           []string
+	exclusions        []restarter.WorkloadPattern
+	customOwnerSpecs  []string
+	customOwners      []restarter.CustomOwner
+	namespaces        []string
+	allNamespaces     bool
+	output            string
+	reportFile        string
+	verbosity         int
+	qps               float32
+	burst             int
+	protobuf          bool
+	retry             restarter.RetryPolicy
+	caches            *cacheSet
+	interval          time.Duration
+	dryRun            bool
+	diff              bool
+	yes               bool
+	force             bool
+	concurrency       int
+	batchSize         int
+	healthCheck       string
+	preHook           string
+	postHook          string
+	postHookTimeout   time.Duration
+	stagger           time.Duration
+	wait              bool
+	ordered           bool
+	partitioned       bool
+	roleLabel         string
+	primaryRoles      []string
+	switchoverHook    string
+	drainSeconds      int
+	checkImages       bool
+	ifChanged         []string
+	configRefs        []restarter.ConfigRef
+	consumerSpecs     []string
+	consumers         []restarter.Consumer
+	workloads         []restarter.WorkloadRef
+	auditLog          string
+	orderSpecs        []string
+	cooldown          time.Duration
+	resumePaused      bool
+	federationContext string
+	argoCDServer      string
+	promQLGateSpec    string
+	prometheusURL     string
+	promQLGateTimeout time.Duration
+	promQLGate        *restarter.PromQLGate
+	caughtUpCheck     string
+	hookTimeout       time.Duration
+	caughtUpTimeout   time.Duration
+	canary            bool
+	imageMatch        []string
+	imagePatterns     []restarter.NamePattern
+	celSpecs          []string
+	expressions       []restarter.PodExpression
+	nodes             []string
+	nodeSelector      string
+	pvcs              []string
+	storageClasses    []string
+	minRestarts       int32
+	lastState         string
+	olderThanSpec     string
+	olderThan         time.Duration
+	memoryAboveSpec   string
+	cpuAboveSpec      string
+	memoryAbove       restarter.UsageThreshold
+	cpuAbove          restarter.UsageThreshold
+	order             [][]restarter.WorkloadPattern
+	backup            string
+	backupStorage     string
+	veleroNamespace   string
+	backupTimeout     time.Duration
+	strategy          string
+	onError           string
+	timeout           time.Duration
+	workloadTimeout   time.Duration
+	deadline          time.Duration
+	reason            string
+	reasonTemplate    string
+	eventTemplate     string
+	reasonTmpl        *template.Template
+	eventTmpl         *template.Template
+	runID             string
+	resume            string
+	stateDir          string
+	state             *runState
+	progress          *progressUI
+	progressHook      func(restarter.Progress)
+
+	includeHealthy bool
+
+	notifyWebhook  string
+	notifyFormat   string
+	notifyTemplate string
+	notifyTmpl     *template.Template
+
+	windowSpec    string
+	window        *maintenanceWindow
+	waitForWindow bool
+
+	watch            bool
+	restartThreshold int32
+	watchCooldown    time.Duration
+	watchSecret      string
+	settle           time.Duration
+
+	resync time.Duration
+
+	scheduleSpec            string
+	schedule                cron.Schedule
+	leaderElect             bool
+	leaderElectionNamespace string
+	leaderElectionID        string
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	cmd := &cobra.Command{
+		Use:   "my-k8s-redeploy",
+		Short: "Gracefully restart the workloads behind matching pods",
+		Long: `Gracefully restart the workloads behind matching pods.
+
+Exit codes:
+  0  success
+  1  error before or outside of restarting (bad flags, unreachable cluster, ...)
+  2  no workloads matched
+  3  some workload restarts failed
+  4  every workload restart failed`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.complete(cmd)
+		},
+	}
+
+	// The kubeconfig, context and authentication flags are kubectl's own and
+	// load the configuration the way kubectl does. --namespace stays ours
+	// since it takes several namespaces.
+	opts.configFlags = genericclioptions.NewConfigFlags(false)
+	opts.configFlags.Context = &opts.context
+	opts.configFlags.Namespace = nil
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.configFile, "config", defaultConfigPath(), "YAML file with defaults for selectors, namespaces, concurrency, notifications and the maintenance window; flags override it")
+	opts.configFlags.AddFlags(flags)
+	flags.StringSliceVar(&opts.contexts, "contexts", nil, "run against each of these kubeconfig contexts in turn; comma-separated")
+	flags.StringVar(&opts.fleet, "fleet", "", "run against every cluster of this fleet from the config file")
+	flags.IntVar(&opts.fleetParallelism, "fleet-parallelism", 0, "how many clusters of the --fleet to run against at once (defaults to the fleet's parallelism, or 1)")
+	flags.StringVarP(&opts.selector, "selector", "l", "", "label selector to filter pods on (e.g. app=postgres,tier=db)")
+	flags.StringArrayVar(&opts.helmReleases, "helm-release", nil, "only match pods of this Helm release, labeled app.kubernetes.io/instance=NAME, e.g. to restart everything in the postgres-prod release; repeatable")
+	flags.StringVar(&opts.fieldSelector, "field-selector", "", "field selector to filter pods on (e.g. spec.nodeName=node-3,status.phase=Running)")
+	flags.StringArrayVar(&opts.match, "match", nil, "pod name pattern; a glob (db-*) or a regex prefixed with re: (re:^pg-\\d+$), repeatable (defaults to *database* when no --selector, --helm-release, --image-match, --cel, --pvc, --storage-class status or usage filter is given)")
+	flags.StringArrayVar(&opts.nodes, "node", nil, "only match pods scheduled on this node, e.g. to roll databases off it before maintenance; repeatable")
+	flags.StringVar(&opts.nodeSelector, "node-selector", "", "only match pods scheduled on nodes with these labels, e.g. topology.kubernetes.io/zone=eu-west-1a")
+	flags.StringArrayVar(&opts.pvcs, "pvc", nil, "only match pods mounting this PersistentVolumeClaim, as NAME or NAMESPACE/NAME; repeatable")
+	flags.StringArrayVar(&opts.storageClasses, "storage-class", nil, "only match pods mounting a PersistentVolumeClaim of this StorageClass, e.g. to cycle every database on a storage backend after CSI driver or SAN maintenance; repeatable")
+	flags.Int32Var(&opts.minRestarts, "min-restarts", 0, "only match pods with a container that has restarted at least this many times")
+	flags.StringVar(&opts.lastState, "last-state", "", "only match pods with a container whose last termination reason is this, e.g. OOMKilled or Error")
+	flags.StringVar(&opts.olderThanSpec, "older-than", "", "only match pods started longer ago than this, e.g. 36h or 30d")
+	flags.StringVar(&opts.memoryAboveSpec, "memory-above", "", "only match pods with a container using more memory, according to metrics-server, than this percentage of its limit (or request) or quantity, e.g. 90% or 3Gi")
+	flags.StringVar(&opts.cpuAboveSpec, "cpu-above", "", "only match pods with a container using more CPU, according to metrics-server, than this percentage of its limit (or request) or quantity, e.g. 80% or 1500m")
+	flags.StringArrayVar(&opts.celSpecs, "cel", nil, "CEL expression pods must satisfy, evaluated against the pod as pod, e.g. \"pod.metadata.labels['tier'] == 'db' && pod.status.containerStatuses.exists(c, c.restartCount > 3)\"; repeatable")
+	flags.StringArrayVar(&opts.imageMatch, "image-match", nil, "container image pattern, matched against the full image or its last path segment; a glob (postgres:14.*) or a regex prefixed with re:; pods need a matching container as well as a matching name, repeatable")
+	flags.StringSliceVarP(&opts.namespaces, "namespace", "n", nil, "namespaces to target; repeatable or comma-separated (defaults to the kubeconfig's current namespace)")
+	flags.BoolVarP(&opts.allNamespaces, "all-namespaces", "A", false, "target matching pods in every namespace")
+	flags.StringSliceVar(&opts.excludeNamespaces, "exclude-namespace", nil, "never touch pods in these namespaces, globs allowed (e.g. kube-*); repeatable or comma-separated, added to the config file's")
+	flags.StringArrayVar(&opts.customOwnerSpecs, "custom-owner", nil, "restart pods controlled by this kind, directly or through a StatefulSet, Deployment or DaemonSet, by setting a field on it to the current time: KIND=FIELD.PATH, e.g. PerconaXtraDBCluster=metadata.annotations[restart-tool/restartedAt]; repeatable")
+	flags.StringArrayVar(&opts.exclude, "exclude", nil, "never restart workloads matching [KIND/]NAMESPACE/NAME, globs allowed (e.g. StatefulSet/prod/postgres); repeatable, added to the config file's")
+	flags.StringVarP(&opts.output, "output", "o", "text", "output format: text, json or yaml")
+	flags.StringVar(&opts.reportFile, "report-file", "", "also write the run's report, with every matched pod, its workload, the action taken, its duration, rollout and error, to this file: HTML when it ends in .html, YAML in .yaml or .yml, JSON otherwise")
+	flags.Float32Var(&opts.qps, "qps", 0, "maximum queries per second to the API server (0 uses the client-go default)")
+	flags.BoolVar(&opts.protobuf, "protobuf", true, "talk protobuf rather than JSON to the API server for built-in resources, which makes listing pods on large clusters much cheaper")
+	flags.IntVar(&opts.retry.Retries, "retries", restarter.DefaultRetry.Retries, "how many times to retry an API request that failed transiently (timeouts, 429 and 5xx responses), with exponential backoff; 0 disables retries")
+	flags.DurationVar(&opts.retry.Backoff, "retry-backoff", restarter.DefaultRetry.Backoff, "delay before the first retry of an API request, doubled on every further retry")
+	flags.IntVar(&opts.retry.Budget, "retry-budget", restarter.DefaultRetry.Budget, "most retries of API requests in a run against one cluster, so a struggling API server is not kept busy by them; 0 for no limit")
+	flags.IntVar(&opts.burst, "burst", 0, "maximum burst of queries to the API server (0 uses the client-go default)")
+	flags.IntVarP(&opts.verbosity, "v", "v", 0, "log verbosity; 1 or higher logs every matching decision")
+
+	cmd.AddCommand(
+		newRestartCommand(opts),
+		newPlanCommand(opts),
+		newListCommand(opts),
+		newStatusCommand(opts),
+		newRollbackCommand(opts),
+		newOperatorCommand(opts),
+		newNodeMaintenanceCommand(opts),
+		newServeCommand(opts),
+	)
+	return cmd
+}
+
+func newRestartCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restart [KIND/NAME...]",
+		Short: "Rollout restart the workloads owning matching pods, or the named workloads",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.completeWorkloads(cmd, args); err != nil {
+				return err
+			}
+			if opts.watch {
+				return runWatchCommand(cmd.Context(), opts)
+			}
+			if opts.watchSecret != "" {
+				return runWatchSecretCommand(cmd.Context(), opts)
+			}
+			if opts.schedule != nil {
+				return runScheduleCommand(cmd.Context(), opts)
+			}
+			return opts.run(cmd.Context(), runRestart)
+		},
+	}
+	addRestartFlags(cmd, opts)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "print the workloads that would be restarted without changing anything")
+	cmd.Flags().BoolVar(&opts.diff, "diff", false, "show a diff of what the restart will write to each workload before restarting it, or with --dry-run")
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "restart without asking for confirmation")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 0, "pause between starting workload restarts, with up to 25% jitter")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 1, "number of workloads to restart in parallel")
+	cmd.Flags().IntVar(&opts.batchSize, "batch-size", 0, "restart workloads in waves of this many, finishing each wave (and its rollouts with --wait) before starting the next; overrides --concurrency")
+	cmd.Flags().DurationVar(&opts.stagger, "stagger", 0, "with --batch-size, pause this long between waves")
+	cmd.Flags().StringVar(&opts.preHook, "pre-hook", "", "command to exec in each matching pod before its workload is restarted, e.g. \"pg_ctl -D /data stop -m fast\"; a failure skips the restart")
+	cmd.Flags().IntVar(&opts.drainSeconds, "drain-seconds", 0, "give each pod this long to drain connections and shut down instead of its terminationGracePeriodSeconds; applies to pods the tool deletes itself (--strategy delete-pods or evict, --ordered, --role-label, --canary, OnDelete StatefulSets and InnoDBClusters)")
+	cmd.Flags().StringVar(&opts.switchoverHook, "switchover-hook", "", "with --role-label, command to exec in the primary pod before it is deleted, e.g. \"patronictl switchover --force\"; a failure stops the restart")
+	cmd.Flags().BoolVar(&opts.canary, "canary", false, "before each rollout restart, delete a single matching pod and wait for its replacement to become ready and pass --health-check; a failure leaves the other pods untouched")
+	cmd.Flags().BoolVar(&opts.checkImages, "check-images", false, "before restarting each workload, pull its images in a short-lived pod on one of its nodes and skip the restart if any cannot be pulled")
+	cmd.Flags().StringVar(&opts.backup, "backup", "", "back up before restarting each workload and wait for the backup to complete: velero (a Velero Backup of the workload's namespace) or operator (the database operator's own backup)")
+	cmd.Flags().StringVar(&opts.backupStorage, "backup-storage", "", "with --backup operator, the Percona storage name or Oracle MySQL backup profile to back up to")
+	cmd.Flags().StringVar(&opts.veleroNamespace, "velero-namespace", "velero", "with --backup velero, the namespace Velero runs in")
+	cmd.Flags().DurationVar(&opts.backupTimeout, "backup-timeout", 30*time.Minute, "how long to wait for each --backup to complete before failing the workload")
+	cmd.Flags().StringVar(&opts.postHook, "post-hook", "", "command to exec in every ready pod after each rollout, retried until it succeeds, e.g. \"pg_isready -h localhost\"; implies --wait")
+	cmd.Flags().DurationVar(&opts.hookTimeout, "hook-timeout", 0, "kill each run of --pre-hook, --switchover-hook or --post-hook that takes longer than this (by default only the step's own timeout applies)")
+	cmd.Flags().DurationVar(&opts.postHookTimeout, "post-hook-timeout", 0, "how long to keep retrying --post-hook before failing the run (defaults to --timeout)")
+	cmd.Flags().StringVar(&opts.healthCheck, "health-check", "", "check every ready pod after each rollout and stop restarting on failure: an http(s) URL template (http://{{.IP}}:8080/healthz), tcp:PORT or exec:COMMAND; implies --wait")
+	cmd.Flags().StringVar(&opts.resume, "resume", "", "continue the interrupted or failed run with this run ID, skipping the workloads it already restarted")
+	cmd.Flags().StringVar(&opts.stateDir, "state-dir", defaultStateDir(), "directory where each run records the workloads it restarted, for --resume; empty disables")
+	cmd.Flags().StringVar(&opts.reason, "reason", "", "why the workloads are being restarted, recorded in their restart-tool/reason annotation (defaults to why their pods matched)")
+	cmd.Flags().StringVar(&opts.reasonTemplate, "reason-template", "", "Go template for the restart-tool/reason annotation, executed with .Kind, .Namespace, .Name, .Pods, .Labels (of the first matching pod), .Action, .Reason, .RunID and .Initiator, e.g. \"{{.Reason}} ({{.Initiator}}, change {{.Labels.change}})\"")
+	cmd.Flags().StringVar(&opts.eventTemplate, "event-template", "", "Go template for the message of the RestartTriggered event, with the same fields as --reason-template")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "restart even when a PodDisruptionBudget currently allows no disruptions (has no effect with --strategy evict)")
+	cmd.Flags().BoolVar(&opts.wait, "wait", false, "wait for each restarted workload to finish rolling out, showing live progress (a table on a terminal, one line per change otherwise)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for each rollout when --wait is set, or for each pod when --ordered or a pod --strategy is set")
+	addDeadlineFlags(cmd, opts)
+	cmd.Flags().BoolVar(&opts.watch, "watch", false, "keep running and restart workloads whose matching pods enter CrashLoopBackOff")
+	cmd.Flags().Int32Var(&opts.restartThreshold, "restart-threshold", 0, "with --watch, also restart workloads whose pods have restarted at least this many times (0 disables)")
+	cmd.Flags().DurationVar(&opts.watchCooldown, "watch-cooldown", 10*time.Minute, "with --watch, minimum time between restarts of the same workload")
+	cmd.Flags().StringVar(&opts.watchSecret, "watch-secret", "", "keep running and, whenever this Secret's data changes, restart the matching workloads whose pods mount it or read it through env or envFrom; without --match or --selector every consumer matches")
+	cmd.Flags().DurationVar(&opts.settle, "settle", 30*time.Second, "with --watch-secret, wait this long after the last change to the Secret before restarting its consumers")
+	cmd.Flags().StringVar(&opts.notifyWebhook, "notify-webhook", "", "post a summary of the restart results to this webhook URL")
+	cmd.Flags().StringVar(&opts.notifyFormat, "notify-format", "slack", "payload for --notify-webhook: slack (a Slack-compatible text message), json (the full report) or template (--notify-template)")
+	cmd.Flags().StringVar(&opts.notifyTemplate, "notify-template", "", "Go template rendering the --notify-webhook payload from .Reports, .RunID, .Initiator and .Summary (the slack text), e.g. '{\"text\": {{json .Summary}}}'; implies --notify-format template")
+	cmd.Flags().StringVar(&opts.scheduleSpec, "schedule", "", "keep running and restart on this cron schedule, e.g. \"0 3 * * 0\"; implies --yes")
+	addLeaderElectionFlags(cmd, opts)
+	cmd.Flags().StringVar(&opts.windowSpec, "window", "", "only restart inside this maintenance window, e.g. \"Sat 02:00-04:00 America/New_York\" or \"Mon-Fri 22:00-02:00 UTC\"")
+	cmd.Flags().BoolVar(&opts.waitForWindow, "wait-for-window", false, "when outside --window, wait for it to open instead of failing")
+	return cmd
+}
+
+func newPlanCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan [KIND/NAME...]",
+		Short: "Print the workloads restart would act on without changing anything",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.completeWorkloads(cmd, args); err != nil {
+				return err
+			}
+			opts.dryRun = true
+			return opts.run(cmd.Context(), runRestart)
+		},
+	}
+	addRestartFlags(cmd, opts)
+	return cmd
+}
+
+func addRestartFlags(cmd *cobra.Command, opts *options) {
+	cmd.Flags().BoolVar(&opts.ordered, "ordered", false, "restart StatefulSets by deleting pods one at a time from the highest ordinal, waiting for each replacement to become ready")
+	cmd.Flags().BoolVar(&opts.partitioned, "partitioned", false, "restart RollingUpdate StatefulSets by lowering their partition one ordinal at a time from the highest, waiting for each pod to be updated, ready and healthy; resumes a partitioned restart that was interrupted")
+	cmd.Flags().StringVar(&opts.roleLabel, "role-label", "", "restart StatefulSet pods one at a time ordered by this pod label, replicas first and the primary last, waiting for each to become ready; implies --ordered")
+	cmd.Flags().StringVar(&opts.caughtUpCheck, "caught-up-check", "", "after each StatefulSet pod an ordered, partitioned or OnDelete restart replaces is ready, retry this until the replica has caught up before taking down the next: exec:COMMAND run in the pod, or promql:CONDITION queried from --prometheus-url with the pod's .Name, .Namespace and .IP, e.g. 'promql:pg_replication_lag_seconds{pod=\"{{.Name}}\"} < 5'")
+	cmd.Flags().DurationVar(&opts.caughtUpTimeout, "caught-up-timeout", 0, "how long to retry --caught-up-check for each pod (defaults to --timeout)")
+	cmd.Flags().StringSliceVar(&opts.primaryRoles, "primary-role", []string{"master", "primary", "leader"}, "values of --role-label that mark a primary")
+	cmd.Flags().StringVar(&opts.auditLog, "audit-configmap", "", "record who restarted each workload, when, why and with what result in this ConfigMap of its namespace, which keeps the most recent records, e.g. restart-audit")
+	cmd.Flags().DurationVar(&opts.cooldown, "cooldown", 0, "skip workloads restarted less than this long ago, by this tool or kubectl rollout restart, e.g. 30m")
+	cmd.Flags().StringVar(&opts.federationContext, "federation-context", "", "kubeconfig context of the Karmada control plane; workloads it propagates are restarted by patching their resource template there (by default they are skipped, since a restart of the local copy would be reverted)")
+	cmd.Flags().StringVar(&opts.promQLGateSpec, "promql-gate", "", "only restart each workload once this PromQL condition holds for every sample, a Go template with the --reason-template fields, e.g. 'max(pg_replication_lag_seconds{namespace=\"{{.Namespace}}\"}) < 10'; requires --prometheus-url")
+	cmd.Flags().StringVar(&opts.prometheusURL, "prometheus-url", "", "base URL of the Prometheus API --promql-gate and a promql: --caught-up-check query, e.g. http://prometheus.monitoring:9090")
+	cmd.Flags().DurationVar(&opts.promQLGateTimeout, "promql-gate-timeout", 0, "keep querying --promql-gate this long, deferring the restart, before failing the workload (by default it fails at once)")
+	cmd.Flags().StringVar(&opts.argoCDServer, "argocd-server", "", "Argo CD API server URL; Deployments, StatefulSets and DaemonSets its Applications manage are restarted through their restart action so they do not drift (the token is read from ARGOCD_AUTH_TOKEN)")
+	cmd.Flags().BoolVar(&opts.resumePaused, "resume-paused", false, "restart paused Deployments by resuming them, waiting for the rollout and pausing them again (by default they are skipped)")
+	cmd.Flags().StringArrayVar(&opts.orderSpecs, "order", nil, "restart workloads matching each [KIND/]NAMESPACE/NAME pattern, and wait for them, before those matching the next, e.g. StatefulSet/prod/postgres>Deployment/prod/*; adds to restart-tool/depends-on annotations; repeatable")
+	cmd.Flags().StringArrayVar(&opts.consumerSpecs, "consumer", nil, "Deployment, as NAMESPACE/NAME, that connects to the databases; it is scaled to zero before the first restart and back once every workload is done, so its clients do not all reconnect to a freshly restarted primary; repeatable")
+	cmd.Flags().StringSliceVar(&opts.ifChanged, "if-changed", nil, "only restart workloads whose restart-tool/config-hash annotation differs from the hash of these ConfigMaps and Secrets in their namespace, e.g. configmap/postgres-config,secret/postgres-tls; the new hash is recorded after a successful restart")
+	cmd.Flags().StringVar(&opts.onError, "on-error", "continue", "what a failed workload restart does to the rest of the plan: continue (restart the others; a failed --health-check still stops the run), stop (restart no more workloads) or rollback (stop and roll back the Deployments already restarted and the one that failed)")
+	cmd.Flags().StringVar(&opts.strategy, "strategy", "rollout", "how to restart workloads: rollout (restart the whole workload) delete-pods (delete only the matching pods one at a time, honoring PodDisruptionBudgets) evict (evict the matching pods one at a time through the Eviction API, retrying while a PodDisruptionBudget refuses) or scale-bounce (scale Deployments and StatefulSets to zero, wait for every pod to terminate and scale them back, for databases that cannot run two pods at once)")
+}
+
+func addDeadlineFlags(cmd *cobra.Command, opts *options) {
+	cmd.Flags().DurationVar(&opts.workloadTimeout, "workload-timeout", 0, "fail a workload that has not finished restarting, including its checks, backup, rollout and hooks, after this long, e.g. 20m (0 disables)")
+	cmd.Flags().DurationVar(&opts.deadline, "deadline", 0, "stop a run that has not finished after this long, failing the workloads in progress and skipping the rest, e.g. 2h (0 disables)")
+}
+
+func addLeaderElectionFlags(cmd *cobra.Command, opts *options) {
+	cmd.Flags().BoolVar(&opts.leaderElect, "leader-elect", true, "in long-running modes, hold a Lease so only one replica performs restarts")
+	cmd.Flags().StringVar(&opts.leaderElectionNamespace, "leader-election-namespace", "", "namespace of the leader election Lease (defaults to the current namespace)")
+	cmd.Flags().StringVar(&opts.leaderElectionID, "leader-election-id", "database-restarter", "name of the leader election Lease")
+}
+
+func newListCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the workloads owning matching pods",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.run(cmd.Context(), runList)
+		},
+	}
+}
+
+func newStatusCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Report rollout progress of the workloads owning matching pods",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.run(cmd.Context(), runStatus)
+		},
+	}
+}
+
+func newRollbackCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Undo the last restart of matching deployments whose new pods are not becoming healthy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.run(cmd.Context(), runRollback)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.includeHealthy, "include-healthy", false, "also roll back deployments whose restarted rollout is healthy")
+	return cmd
+}
+
+func (o *options) complete(cmd *cobra.Command) error {
+	switch o.output {
+	case "text":
+	case "json", "yaml":
+		logOutput = os.Stderr
+	default:
+		return fmt.Errorf("unsupported --output %q: must be text, json or yaml", o.output)
+	}
+
+	level := slog.LevelInfo
+	if o.verbosity > 0 {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(logSink{}, &slog.HandlerOptions{Level: level})))
+
+	if o.configFile != "" {
+		config, err := loadConfigFile(o.configFile, cmd.Flags().Changed("config"))
+		if err != nil {
+			return err
+		}
+		if config != nil {
+			config.apply(cmd, o)
+		}
+	}
+
+	if o.allNamespaces && len(o.namespaces) > 0 {
+		return fmt.Errorf("--namespace and --all-namespaces are mutually exclusive")
+	}
+	if len(*o.configFlags.ImpersonateGroup) > 0 && *o.configFlags.Impersonate == "" {
+		return fmt.Errorf("--as-group requires --as")
+	}
+	if o.context != "" && len(o.contexts) > 0 {
+		return fmt.Errorf("--context and --contexts are mutually exclusive")
+	}
+	if o.fleet != "" {
+		if err := o.completeFleet(cmd); err != nil {
+			return err
+		}
+	}
+	if o.watch && (len(o.contexts) > 1 || o.fleet != "") {
+		return fmt.Errorf("--watch can only run against a single context")
+	}
+	if o.watchSecret != "" {
+		if o.watch {
+			return fmt.Errorf("--watch-secret cannot be combined with --watch")
+		}
+		if len(o.contexts) > 1 || o.fleet != "" {
+			return fmt.Errorf("--watch-secret can only run against a single context")
+		}
+	}
+	if o.partitioned && (o.ordered || o.roleLabel != "") {
+		return fmt.Errorf("--partitioned cannot be combined with --ordered or --role-label")
+	}
+	switch o.strategy {
+	case "", "rollout":
+	case "delete-pods", "evict":
+		if o.partitioned {
+			return fmt.Errorf("--partitioned cannot be combined with --strategy %s", o.strategy)
+		}
+		if o.ordered || o.roleLabel != "" {
+			return fmt.Errorf("--ordered and --role-label cannot be combined with --strategy %s", o.strategy)
+		}
+		if o.canary {
+			return fmt.Errorf("--canary cannot be combined with --strategy %s, which already replaces one pod at a time", o.strategy)
+		}
+	case "scale-bounce":
+		if o.ordered || o.roleLabel != "" || o.canary || o.partitioned {
+			return fmt.Errorf("--ordered, --role-label, --partitioned and --canary cannot be combined with --strategy scale-bounce, which stops every pod at once")
+		}
+	default:
+		return fmt.Errorf("unsupported --strategy %q: must be rollout, delete-pods, evict or scale-bounce", o.strategy)
+	}
+	if o.retry.Retries < 0 || o.retry.Budget < 0 {
+		return fmt.Errorf("--retries and --retry-budget must not be negative")
+	}
+	if o.retry.Retries > 0 && o.retry.Backoff <= 0 {
+		return fmt.Errorf("--retry-backoff must be positive")
+	}
+	switch o.onError {
+	case "", "continue", "stop", "rollback":
+	default:
+		return fmt.Errorf("unsupported --on-error %q: must be continue, stop or rollback", o.onError)
+	}
+	if o.argoCDServer != "" && os.Getenv("ARGOCD_AUTH_TOKEN") == "" {
+		return fmt.Errorf("--argocd-server needs an API token in ARGOCD_AUTH_TOKEN")
+	}
+	if strings.HasPrefix(o.caughtUpCheck, "promql:") && o.prometheusURL == "" {
+		return fmt.Errorf("a promql: --caught-up-check requires --prometheus-url")
+	}
+	if o.promQLGateSpec != "" {
+		if o.prometheusURL == "" {
+			return fmt.Errorf("--promql-gate requires --prometheus-url")
+		}
+		gate, err := restarter.ParsePromQLGate(o.promQLGateSpec)
+		if err != nil {
+			return fmt.Errorf("invalid --promql-gate: %w", err)
+		}
+		gate.Server, gate.Timeout = o.prometheusURL, o.promQLGateTimeout
+		gate.Client = &http.Client{Timeout: prometheusTimeout}
+		o.promQLGate = gate
+	}
+	if o.drainSeconds < 0 {
+		return fmt.Errorf("--drain-seconds must not be negative")
+	}
+	// OnDelete StatefulSets and InnoDBClusters only show up in the plan, so
+	// this warns rather than refusing the run.
+	if o.drainSeconds > 0 && o.strategy != "delete-pods" && o.strategy != "evict" && !o.ordered && o.roleLabel == "" && !o.canary {
+		slog.Warn("--drain-seconds only applies to pods the tool deletes itself, such as those of OnDelete StatefulSets and InnoDBClusters; rollout restarts leave pod termination to the workload's controller")
+	}
+	if o.switchoverHook != "" && o.roleLabel == "" {
+		return fmt.Errorf("--switchover-hook requires --role-label")
+	}
+	switch o.backup {
+	case "", "velero", "operator":
+	default:
+		return fmt.Errorf("unsupported --backup %q: must be velero or operator", o.backup)
+	}
+	if o.healthCheck != "" || o.postHook != "" {
+		o.wait = true
+	}
+	if o.scheduleSpec != "" {
+		if o.watch || o.watchSecret != "" {
+			return fmt.Errorf("--schedule cannot be combined with --watch or --watch-secret")
+		}
+		schedule, err := cron.ParseStandard(o.scheduleSpec)
+		if err != nil {
+			return fmt.Errorf("invalid --schedule %q: %w", o.scheduleSpec, err)
+		}
+		o.schedule = schedule
+		o.yes = true
+	}
+	if o.notifyTemplate != "" {
+		tmpl, err := template.New("notify-template").Funcs(template.FuncMap{"json": toJSON}).Parse(o.notifyTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid --notify-template: %w", err)
+		}
+		o.notifyTmpl = tmpl
+		o.notifyFormat = "template"
+	}
+	switch o.notifyFormat {
+	case "", "slack", "json":
+	case "template":
+		if o.notifyTmpl == nil {
+			return fmt.Errorf("--notify-format template requires --notify-template")
+		}
+	default:
+		return fmt.Errorf("unsupported --notify-format %q: must be slack, json or template", o.notifyFormat)
+	}
+	if o.reasonTemplate != "" {
+		tmpl, err := template.New("reason-template").Parse(o.reasonTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid --reason-template: %w", err)
+		}
+		o.reasonTmpl = tmpl
+	}
+	if o.eventTemplate != "" {
+		tmpl, err := template.New("event-template").Parse(o.eventTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid --event-template: %w", err)
+		}
+		o.eventTmpl = tmpl
+	}
+	if o.windowSpec != "" {
+		if o.watch || o.watchSecret != "" {
+			return fmt.Errorf("--window cannot be combined with --watch or --watch-secret")
+		}
+		window, err := parseWindow(o.windowSpec)
+		if err != nil {
+			return err
+		}
+		o.window = window
+	}
+
+	statusFilters := o.minRestarts > 0 || o.lastState != "" || o.olderThanSpec != "" || len(o.celSpecs) > 0 || o.memoryAboveSpec != "" || o.cpuAboveSpec != ""
+	storageFilters := len(o.pvcs) > 0 || len(o.storageClasses) > 0
+	if errs := validation.IsDNS1123Subdomain(o.auditLog); o.auditLog != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid --audit-configmap %q: %s", o.auditLog, strings.Join(errs, ", "))
+	}
+	for _, release := range o.helmReleases {
+		if errs := validation.IsValidLabelValue(release); release == "" || len(errs) > 0 {
+			return fmt.Errorf("invalid --helm-release %q", release)
+		}
+	}
+	if len(o.match) == 0 && o.selector == "" && len(o.helmReleases) == 0 && o.watchSecret == "" && len(o.imageMatch) == 0 && !statusFilters && !storageFilters {
+		o.match = []string{"*database*"}
+	}
+	for _, namespace := range o.excludeNamespaces {
+		if _, err := path.Match(namespace, ""); err != nil {
+			return fmt.Errorf("invalid --exclude-namespace %q: %w", namespace, err)
+		}
+	}
+	for _, raw := range o.customOwnerSpecs {
+		owner, err := restarter.ParseCustomOwner(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --custom-owner: %w", err)
+		}
+		o.customOwners = append(o.customOwners, owner)
+	}
+	if o.olderThanSpec != "" {
+		olderThan, err := parseAge(o.olderThanSpec)
+		if err != nil {
+			return fmt.Errorf("invalid --older-than: %w", err)
+		}
+		o.olderThan = olderThan
+	}
+	if o.memoryAboveSpec != "" {
+		threshold, err := restarter.ParseUsageThreshold(o.memoryAboveSpec)
+		if err != nil {
+			return fmt.Errorf("invalid --memory-above: %w", err)
+		}
+		o.memoryAbove = threshold
+	}
+	if o.cpuAboveSpec != "" {
+		threshold, err := restarter.ParseUsageThreshold(o.cpuAboveSpec)
+		if err != nil {
+			return fmt.Errorf("invalid --cpu-above: %w", err)
+		}
+		o.cpuAbove = threshold
+	}
+	if (o.memoryAboveSpec != "" || o.cpuAboveSpec != "") && (o.watch || o.watchSecret != "") {
+		return fmt.Errorf("--memory-above and --cpu-above cannot be combined with --watch or --watch-secret")
+	}
+	for _, raw := range o.celSpecs {
+		expression, err := restarter.ParsePodExpression(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --cel: %w", err)
+		}
+		o.expressions = append(o.expressions, expression)
+	}
+	for _, raw := range o.imageMatch {
+		pattern, err := restarter.ParseNamePattern(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --image-match: %w", err)
+		}
+		o.imagePatterns = append(o.imagePatterns, pattern)
+	}
+	for _, raw := range o.orderSpecs {
+		chain, err := restarter.ParseOrder(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --order: %w", err)
+		}
+		o.order = append(o.order, chain)
+	}
+	for _, raw := range o.ifChanged {
+		ref, err := restarter.ParseConfigRef(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --if-changed: %w", err)
+		}
+		o.configRefs = append(o.configRefs, ref)
+	}
+	for _, raw := range o.consumerSpecs {
+		consumer, err := restarter.ParseConsumer(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --consumer: %w", err)
+		}
+		o.consumers = append(o.consumers, consumer)
+	}
+	for _, raw := range o.exclude {
+		pattern, err := restarter.ParseWorkloadPattern(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --exclude: %w", err)
+		}
+		o.exclusions = append(o.exclusions, pattern)
+	}
+	for _, raw := range o.match {
+		pattern, err := restarter.ParseNamePattern(raw)
+		if err != nil {
+			return fmt.Errorf("invalid --match pattern: %w", err)
+		}
+		o.patterns = append(o.patterns, pattern)
+	}
+
+	return nil
+}
+
+// clientFlags returns the command line's config flags pointed at the cluster
+// o targets: its context and, for a fleet cluster, its kubeconfig. Copies of
+// options target different clusters, so the shared flags are left as they are.
+func (o *options) clientFlags() *genericclioptions.ConfigFlags {
+	flags := &genericclioptions.ConfigFlags{
+		CacheDir:           o.configFlags.CacheDir,
+		KubeConfig:         o.configFlags.KubeConfig,
+		ClusterName:        o.configFlags.ClusterName,
+		AuthInfoName:       o.configFlags.AuthInfoName,
+		Context:            &o.context,
+		APIServer:          o.configFlags.APIServer,
+		TLSServerName:      o.configFlags.TLSServerName,
+		Insecure:           o.configFlags.Insecure,
+		CertFile:           o.configFlags.CertFile,
+		KeyFile:            o.configFlags.KeyFile,
+		CAFile:             o.configFlags.CAFile,
+		BearerToken:        o.configFlags.BearerToken,
+		Impersonate:        o.configFlags.Impersonate,
+		ImpersonateUID:     o.configFlags.ImpersonateUID,
+		ImpersonateGroup:   o.configFlags.ImpersonateGroup,
+		Username:           o.configFlags.Username,
+		Password:           o.configFlags.Password,
+		Timeout:            o.configFlags.Timeout,
+		DisableCompression: o.configFlags.DisableCompression,
+	}
+	if o.kubeconfig != "" {
+		flags.KubeConfig = &o.kubeconfig
+	}
+	return flags
+}
+
+// tuneConfig applies the rate limits and, unless --protobuf=false, asks for
+// protobuf instead of JSON, which is much smaller and faster to decode when
+// listing pods on a large cluster. Responses are gzip-compressed unless
+// --disable-compression is set. The dynamic client always uses JSON.
+func (o *options) tuneConfig(config *rest.Config) {
+	if o.qps > 0 {
+		config.QPS = o.qps
+	}
+	if o.burst > 0 {
+		config.Burst = o.burst
+	}
+	if o.protobuf {
+		config.ContentType = runtime.ContentTypeProtobuf
+		config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+}
+
+func (o *options) connect(ctx context.Context) (*restarter.Restarter, []string, error) {
+	config, namespace, err := loadConfig(o.clientFlags())
+	if err != nil {
+		return nil, nil, err
+	}
+	o.tuneConfig(config)
+	if config.Impersonate.UserName != "" {
+		slog.Info("Impersonating user", "user", config.Impersonate.UserName, "groups", strings.Join(config.Impersonate.Groups, ","))
+	}
+
+	restarterOpts := o.restarterOptions()
+	if o.argoCDServer != "" {
+		restarterOpts.ArgoCD = &restarter.ArgoCD{Server: o.argoCDServer, Token: os.Getenv("ARGOCD_AUTH_TOKEN"), Client: &http.Client{Timeout: argoCDTimeout}}
+	}
+	if o.federationContext != "" {
+		federation := *o
+		federation.context = o.federationContext
+		federationConfig, _, err := loadConfig(federation.clientFlags())
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading --federation-context: %w", err)
+		}
+		if restarterOpts.Federation, err = dynamic.NewForConfig(federationConfig); err != nil {
+			return nil, nil, err
+		}
+	}
+	if o.healthCheck != "" {
+		if restarterOpts.HealthCheck, err = restarter.ParseHealthCheck(o.healthCheck, config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.caughtUpCheck != "" {
+		restarterOpts.CaughtUp, err = restarter.ParseCaughtUpCheck(o.caughtUpCheck, config, o.prometheusURL, &http.Client{Timeout: prometheusTimeout})
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --caught-up-check: %w", err)
+		}
+		restarterOpts.CaughtUpTimeout = o.caughtUpTimeout
+	}
+
+	if o.preHook != "" {
+		if restarterOpts.PreHook, err = restarter.NewExecHook(config, strings.Fields(o.preHook), o.hookTimeout); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.switchoverHook != "" {
+		if restarterOpts.SwitchoverHook, err = restarter.NewExecHook(config, strings.Fields(o.switchoverHook), o.hookTimeout); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.postHook != "" {
+		if restarterOpts.PostHook, err = restarter.NewExecHook(config, strings.Fields(o.postHook), o.hookTimeout); err != nil {
+			return nil, nil, err
+		}
+		restarterOpts.PostHookTimeout = o.postHookTimeout
+	}
+
+	r, err := restarter.NewForConfig(config, restarterOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.Preflight(ctx); err != nil {
+		return nil, nil, fmt.Errorf("pre-flight check against %s failed: %w", config.Host, err)
+	}
+
+	namespaces := resolveNamespaces(namespace, o)
+	if o.caches != nil {
+		cache, err := o.caches.get(restarter.WithRetry(config, o.retry, nil), namespaces)
+		if err != nil {
+			return nil, nil, err
+		}
+		r.UseCache(cache)
+	}
+	return r, namespaces, nil
+}
+
+func (o *options) restarterOptions() restarter.Options {
+	return restarter.Options{
+		Selector:          o.selector,
+		HelmReleases:      o.helmReleases,
+		FieldSelector:     o.fieldSelector,
+		Patterns:          o.patterns,
+		ImagePatterns:     o.imagePatterns,
+		Expressions:       o.expressions,
+		Nodes:             o.nodes,
+		NodeSelector:      o.nodeSelector,
+		PVCs:              o.pvcs,
+		StorageClasses:    o.storageClasses,
+		MinRestarts:       o.minRestarts,
+		LastState:         o.lastState,
+		OlderThan:         o.olderThan,
+		MemoryAbove:       o.memoryAbove,
+		CPUAbove:          o.cpuAbove,
+		ExcludeNamespaces: o.excludeNamespaces,
+		Exclude:           o.exclusions,
+		CustomOwners:      o.customOwners,
+		IfChanged:         o.configRefs,
+		Consumers:         o.consumers,
+		Order:             o.order,
+		Cooldown:          o.cooldown,
+		AuditLog:          o.auditLog,
+		PromQLGate:        o.promQLGate,
+		ResumePaused:      o.resumePaused,
+		Canary:            o.canary,
+		Ordered:           o.ordered,
+		Partitioned:       o.partitioned,
+		RoleLabel:         o.roleLabel,
+		PrimaryRoles:      o.primaryRoles,
+		DrainPeriod:       time.Duration(o.drainSeconds) * time.Second,
+		CheckImages:       o.checkImages,
+		Backup:            o.backup,
+		BackupStorage:     o.backupStorage,
+		VeleroNamespace:   o.veleroNamespace,
+		BackupTimeout:     o.backupTimeout,
+		OnError:           o.onError,
+		Retry:             o.retry,
+		Strategy:          o.strategy,
+		Force:             o.force,
+		Wait:              o.wait,
+		Timeout:           o.timeout,
+		WorkloadTimeout:   o.workloadTimeout,
+		Concurrency:       o.concurrency,
+		Interval:          o.interval,
+		BatchSize:         o.batchSize,
+		Stagger:           o.stagger,
+		DryRun:            o.dryRun,
+		RestartThreshold:  o.restartThreshold,
+		WatchCooldown:     o.watchCooldown,
+		Reason:            o.reason,
+		ReasonTemplate:    o.reasonTmpl,
+		EventTemplate:     o.eventTmpl,
+		RunID:             o.runID,
+		OnProgress:        o.showProgress,
+	}
+}
+
+func (o *options) showProgress(p restarter.Progress) {
+	if o.progress != nil {
+		o.progress.update(p)
+	}
+	if o.progressHook != nil {
+		o.progressHook(p)
+	}
+	if o.state != nil && p.Phase == "succeeded" {
+		o.state.record(o.target, p.Workload)
+	}
+}
+
+func (o *options) discover(ctx context.Context) (*restarter.Restarter, *report, error) {
+	rep := &report{RunID: o.runID, StartedAt: time.Now(), DryRun: o.dryRun}
+
+	r, namespaces, err := o.connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(o.workloads) > 0 {
+		refs := make([]restarter.WorkloadRef, len(o.workloads))
+		for i, ref := range o.workloads {
+			ref.Namespace = namespaces[0]
+			refs[i] = ref
+		}
+		rep.Workloads, rep.Skipped, err = r.PlanWorkloads(ctx, refs)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, rep, nil
+	}
+
+	pods, err := r.ListPods(ctx, namespaces)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rep.Workloads, rep.Skipped = r.Plan(ctx, pods)
+	return r, rep, nil
+}
+
+func (o *options) run(ctx context.Context, fn func(ctx context.Context, o *options) (*report, error)) error {
+	targets := o.targets()
+	kind := "context"
+	parallelism := 1
+	if o.fleet != "" {
+		kind = "cluster"
+		parallelism = o.fleetParallelism
+	}
+
+	if o.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.deadline)
+		defer cancel()
+	}
+
+	// Every context restarted by one invocation shares a run ID.
+	o.runID = restarter.NewRunID()
+	o.state = nil
+	if o.resume != "" {
+		o.runID = o.resume
+	}
+	if o.stateDir != "" {
+		state, err := loadRunState(o.stateDir, o.runID, o.resume != "")
+		if err != nil {
+			return err
+		}
+		o.state = state
+	}
+	defer func() {
+		if o.state != nil && len(o.state.Restarted) > 0 && !o.dryRun {
+			slog.Info("Run state recorded, continue this run with --resume", "runId", o.runID)
+		}
+	}()
+
+	// Each target gets its own copy of the options, so that fleet clusters
+	// can run side by side with their own context, kubeconfig and workers.
+	reports := make([]*report, len(targets))
+	errs := make([]error, len(targets))
+	runTarget := func(i int) {
+		t := targets[i]
+		if ctx.Err() != nil {
+			slog.Warn("Skipping "+kind+", the run was "+stopReason(ctx), kind, t.name)
+			reports[i] = &report{Context: t.name, Error: stopReason(ctx) + " before this " + kind + " was started"}
+			errs[i] = errors.New(reports[i].Error)
+			return
+		}
+		to := *o
+		to.target = t.name
+		to.context = t.context
+		to.kubeconfig = t.kubeconfig
+		to.parallel = parallelism > 1
+		if t.concurrency > 0 {
+			to.concurrency = t.concurrency
+		}
+		if len(targets) > 1 || o.fleet != "" {
+			slog.Info("Running against "+kind, kind, t.name)
+		}
+
+		runCtx, span := tracer.Start(ctx, "run", trace.WithAttributes(
+			attribute.String("k8s.context", t.name),
+			attribute.String("restart.run_id", o.runID),
+			attribute.Bool("restart.dry_run", o.dryRun),
+		))
+		rep, err := fn(runCtx, &to)
+		endSpan(span, err)
+		if rep != nil {
+			rep.Context = t.name
+			rep.finish()
+		}
+		reports[i], errs[i] = rep, err
+	}
+
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range targets {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			runTarget(i)
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	unmatched := 0
+	for i, t := range targets {
+		err := errs[i]
+		if err == nil {
+			continue
+		}
+		if len(targets) == 1 {
+			o.notify(compactReports(reports))
+			if writeErr := o.writeReports(compactReports(reports)); writeErr != nil {
+				return writeErr
+			}
+			return err
+		}
+		if exitCode(err) == exitNoMatch {
+			slog.Info("Nothing matched in "+kind, kind, t.name)
+			unmatched++
+			continue
+		}
+		slog.Error("Run failed in "+kind, kind, t.name, "error", err)
+		if reports[i] == nil {
+			reports[i] = &report{Context: t.name, Error: err.Error()}
+		} else {
+			reports[i].Error = err.Error()
+		}
+		failed = append(failed, t.name+": "+err.Error())
+	}
+
+	reports = compactReports(reports)
+	if o.fleet != "" {
+		workloads, failedWorkloads := 0, 0
+		for _, rep := range reports {
+			workloads += len(rep.Workloads)
+			failedWorkloads += countResult(rep.Workloads, "failed")
+		}
+		slog.Info("Fleet run finished", "fleet", o.fleet, "clusters", len(targets), "failedClusters", len(failed), "unmatchedClusters", unmatched, "workloads", workloads, "failedWorkloads", failedWorkloads)
+	}
+	o.notify(reports)
+	if err := o.writeReports(reports); err != nil {
+		return err
+	}
+	if len(failed) == 0 && o.state != nil && !o.dryRun {
+		o.state.remove()
+		o.state = nil
+	}
+	switch {
+	case unmatched == len(targets):
+		return &exitError{code: exitNoMatch, err: fmt.Errorf("no workloads matched in any %s", kind)}
+	case len(failed) == len(targets)-unmatched:
+		return &exitError{code: exitAllFailed, err: fmt.Errorf("failed in every %s: %s", kind, strings.Join(failed, "; "))}
+	case len(failed) > 0:
+		return &exitError{code: exitPartialFailure, err: fmt.Errorf("failed in %d of %d %ss: %s", len(failed), len(targets), kind, strings.Join(failed, "; "))}
+	}
+	return nil
+}
+
+// compactReports drops the targets that produced no report.
+func compactReports(reports []*report) []*report {
+	return slices.DeleteFunc(slices.Clone(reports), func(rep *report) bool { return rep == nil })
+}
+
+// stopReason says why ctx, the context of a run, is done.
+func stopReason(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "stopped at its --deadline"
+	}
+	return "interrupted"
+}
+
+func (o *options) writeReports(reports []*report) error {
+	if o.reportFile != "" && len(reports) > 0 {
+		if err := writeReportFile(o.reportFile, reports); err != nil {
+			return fmt.Errorf("writing --report-file: %w", err)
+		}
+		slog.Info("Wrote report", "file", o.reportFile)
+	}
+	if o.output == "text" || len(reports) == 0 {
+		return nil
+	}
+	if len(o.contexts) == 0 && o.fleet == "" {
+		return writeReport(os.Stdout, o.output, reports[0])
+	}
+	return writeReport(os.Stdout, o.output, reports)
+}
+
+func runWatchCommand(ctx context.Context, opts *options) error {
+	if len(opts.contexts) == 1 {
+		opts.context = opts.contexts[0]
+	}
+	opts.caches = newCacheSet(ctx)
+	r, namespaces, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	return opts.withLeaderElection(ctx, func(ctx context.Context) error {
+		return r.Watch(ctx, namespaces)
+	})
+}
+
+func runWatchSecretCommand(ctx context.Context, opts *options) error {
+	if len(opts.contexts) == 1 {
+		opts.context = opts.contexts[0]
+	}
+	opts.caches = newCacheSet(ctx)
+	r, namespaces, err := opts.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	return opts.withLeaderElection(ctx, func(ctx context.Context) error {
+		return r.WatchSecret(ctx, namespaces, opts.watchSecret, opts.settle)
+	})
+}
+
+func runScheduleCommand(ctx context.Context, opts *options) error {
+	return opts.withLeaderElection(ctx, func(ctx context.Context) error {
+		for {
+			next := opts.schedule.Next(time.Now())
+			slog.Info("Waiting for next scheduled restart", "schedule", opts.scheduleSpec, "next", next.Format(time.RFC3339))
+			select {
+			case <-ctx.Done():
+				slog.Info("Stopping scheduler")
+				return nil
+			case <-time.After(time.Until(next)):
+			}
+
+			if err := opts.run(ctx, runRestart); err != nil && exitCode(err) != exitNoMatch {
+				slog.Error("Scheduled restart failed", "error", err)
+			}
+		}
+	})
+}
+
+func runRestart(ctx context.Context, opts *options) (*report, error) {
+	if !opts.dryRun {
+		if err := opts.enforceWindow(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	r, rep, err := opts.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.state != nil {
+		var done []restarter.SkippedPod
+		rep.Workloads, done = opts.state.pending(opts.target, rep.Workloads)
+		rep.Skipped = append(rep.Skipped, done...)
+		if len(rep.Workloads) == 0 && len(done) > 0 {
+			slog.Info("Every workload of this run was already restarted", "runId", opts.runID)
+			return rep, nil
+		}
+	}
+
+	if opts.dryRun {
+		if opts.output == "text" {
+			printPlan(os.Stdout, rep.Workloads)
+			printSkipped(os.Stdout, rep.Skipped)
+		}
+	}
+	if opts.diff {
+		out := logOutput
+		if opts.dryRun && opts.output == "text" {
+			out = os.Stdout
+		}
+		printDiffs(ctx, out, r, rep.Workloads)
+	}
+	if len(rep.Workloads) == 0 {
+		return rep, &exitError{code: exitNoMatch, err: fmt.Errorf("no workloads matched")}
+	}
+	if opts.dryRun {
+		return rep, nil
+	}
+
+	if !opts.yes && opts.parallel {
+		return rep, fmt.Errorf("plans of clusters run in parallel cannot be confirmed, pass --yes or a --fleet-parallelism of 1")
+	}
+	if !opts.yes && len(rep.Workloads) > 0 && !confirmPlan(ctx, os.Stdin, logOutput, rep.Workloads) {
+		return rep, fmt.Errorf("restart aborted: plan was not confirmed")
+	}
+
+	if opts.wait && !opts.parallel {
+		opts.progress = newProgressUI(logOutput, rep.Workloads)
+	}
+	failed := r.RestartAll(ctx, rep.Workloads)
+	rep.Initiator = r.Initiator(ctx)
+	if opts.progress != nil {
+		opts.progress.finish(rep.Workloads)
+		opts.progress = nil
+	}
+	switch {
+	case ctx.Err() != nil:
+		return rep, fmt.Errorf("restart %s, %d of %d workload(s) not restarted", stopReason(ctx), countResult(rep.Workloads, "skipped"), len(rep.Workloads))
+	case len(failed) == 0:
+		return rep, nil
+	case len(failed) == len(rep.Workloads):
+		return rep, &exitError{code: exitAllFailed, err: fmt.Errorf("all %d workload restart(s) failed", len(failed))}
+	default:
+		return rep, &exitError{code: exitPartialFailure, err: fmt.Errorf("%d of %d workload restart(s) failed", len(failed), len(rep.Workloads))}
+	}
+}
+
+func runList(ctx context.Context, opts *options) (*report, error) {
+	_, rep, err := opts.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.output == "text" {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tPODS\tREASON")
+		for _, w := range rep.Workloads {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", w.Kind, w.Namespace, w.Name, len(w.Pods), w.Reason)
+		}
+		tw.Flush()
+	}
+	return rep, nil
+}
+
+func runStatus(ctx context.Context, opts *options) (*report, error) {
+	r, rep, err := opts.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range rep.Workloads {
+		status, err := r.RolloutStatus(ctx, w.Kind, w.Namespace, w.Name)
+		if err != nil {
+			w.Error = err.Error()
+			continue
+		}
+		w.Rollout = status
+	}
+
+	if opts.output == "text" {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tDESIRED\tUPDATED\tREADY\tCOMPLETE")
+		for _, w := range rep.Workloads {
+			if w.Rollout == nil {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t-\t-\t-\t%s\n", w.Kind, w.Namespace, w.Name, w.Error)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%t\n", w.Kind, w.Namespace, w.Name, w.Rollout.Desired, w.Rollout.Updated, w.Rollout.Ready, w.Rollout.Complete)
+		}
+		tw.Flush()
+	}
+	return rep, nil
+}
+
+func runRollback(ctx context.Context, opts *options) (*report, error) {
+	r, rep, err := opts.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if failed := r.Rollback(ctx, rep.Workloads, opts.includeHealthy); len(failed) > 0 {
+		return rep, &exitError{code: exitPartialFailure, err: fmt.Errorf("%d of %d rollback(s) failed", len(failed), len(rep.Workloads))}
+	}
+	return rep, nil
+}
+
+// parseAge parses a duration that may also be given in whole days, like 30d.
+func parseAge(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+func countResult(workloads []*restarter.Workload, result string) int {
+	n := 0
+	for _, w := range workloads {
+		if w.Result == result {
+			n++
+		}
+	}
+	return n
+}
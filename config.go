@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig holds defaults read from the --config file; flags given on the
+// command line take precedence over it.
+type fileConfig struct {
+	Selector      string       `json:"selector,omitempty"`
+	FieldSelector string       `json:"fieldSelector,omitempty"`
+	Match         []string     `json:"match,omitempty"`
+	Namespaces    []string     `json:"namespaces,omitempty"`
+	CustomOwners  []string     `json:"customOwners,omitempty"`
+	Concurrency   int          `json:"concurrency,omitempty"`
+	BatchSize     int          `json:"batchSize,omitempty"`
+	Window        string       `json:"window,omitempty"`
+	WaitForWindow *bool        `json:"waitForWindow,omitempty"`
+	Notify        notifyConfig `json:"notify,omitempty"`
+
+	// Fleets are named lists of clusters to run against with --fleet.
+	Fleets map[string]fleetConfig `json:"fleets,omitempty"`
+
+	// Exclusions add to the ones given on the command line.
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	Exclude           []string `json:"exclude,omitempty"`
+}
+
+type notifyConfig struct {
+	Webhook  string `json:"webhook,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+type fleetConfig struct {
+	// Parallelism is how many of the clusters are run against at once.
+	Parallelism int             `json:"parallelism,omitempty"`
+	Clusters    []clusterConfig `json:"clusters"`
+}
+
+// clusterConfig is one cluster of a fleet. Name defaults to the context and
+// prefixes the cluster's errors and report.
+type clusterConfig struct {
+	Name        string `json:"name,omitempty"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	Context     string `json:"context,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+}
+
+func defaultConfigPath() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "db-restarter", "config.yaml")
+	}
+	return ""
+}
+
+// loadConfigFile reads path; a missing file is only an error when the user
+// asked for it explicitly.
+func loadConfigFile(path string, explicit bool) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := &fileConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	slog.Debug("Loaded config file", "path", path)
+	return config, nil
+}
+
+// apply copies the config file values into o for every flag that cmd has
+// but that was not set on the command line.
+func (c *fileConfig) apply(cmd *cobra.Command, o *options) {
+	unset := func(name string) bool {
+		flag := cmd.Flags().Lookup(name)
+		return flag != nil && !flag.Changed
+	}
+
+	if c.Selector != "" && unset("selector") {
+		o.selector = c.Selector
+	}
+	if c.FieldSelector != "" && unset("field-selector") {
+		o.fieldSelector = c.FieldSelector
+	}
+	if len(c.Match) > 0 && unset("match") {
+		o.match = c.Match
+	}
+	if len(c.Namespaces) > 0 && unset("namespace") && !o.allNamespaces {
+		o.namespaces = c.Namespaces
+	}
+	o.excludeNamespaces = append(o.excludeNamespaces, c.ExcludeNamespaces...)
+	o.exclude = append(o.exclude, c.Exclude...)
+	if len(c.CustomOwners) > 0 && unset("custom-owner") {
+		o.customOwnerSpecs = c.CustomOwners
+	}
+	if c.Concurrency > 0 && unset("concurrency") {
+		o.concurrency = c.Concurrency
+	}
+	if c.BatchSize > 0 && unset("batch-size") {
+		o.batchSize = c.BatchSize
+	}
+	if c.Window != "" && unset("window") {
+		o.windowSpec = c.Window
+	}
+	if c.WaitForWindow != nil && unset("wait-for-window") {
+		o.waitForWindow = *c.WaitForWindow
+	}
+	if c.Notify.Webhook != "" && unset("notify-webhook") {
+		o.notifyWebhook = c.Notify.Webhook
+	}
+	if c.Notify.Format != "" && unset("notify-format") {
+		o.notifyFormat = c.Notify.Format
+	}
+	if c.Notify.Template != "" && unset("notify-template") {
+		o.notifyTemplate = c.Notify.Template
+	}
+	o.fleets = c.Fleets
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// target is one cluster a run goes against.
+type target struct {
+	name        string
+	kubeconfig  string
+	context     string
+	concurrency int
+}
+
+func (o *options) completeFleet(cmd *cobra.Command) error {
+	if o.context != "" || len(o.contexts) > 0 {
+		return fmt.Errorf("--fleet cannot be combined with --context or --contexts")
+	}
+	fleet, ok := o.fleets[o.fleet]
+	if !ok {
+		return fmt.Errorf("fleet %q is not defined in the config file", o.fleet)
+	}
+	if len(fleet.Clusters) == 0 {
+		return fmt.Errorf("fleet %q has no clusters", o.fleet)
+	}
+
+	names := map[string]bool{}
+	for i, cluster := range fleet.Clusters {
+		name := cluster.Name
+		if name == "" {
+			name = cluster.Context
+		}
+		if name == "" {
+			return fmt.Errorf("cluster %d of fleet %q needs a name or a context", i+1, o.fleet)
+		}
+		if names[name] {
+			return fmt.Errorf("fleet %q lists cluster %q twice", o.fleet, name)
+		}
+		names[name] = true
+		if cluster.Concurrency < 0 {
+			return fmt.Errorf("cluster %q of fleet %q has a negative concurrency", name, o.fleet)
+		}
+	}
+
+	if !cmd.Flags().Changed("fleet-parallelism") {
+		o.fleetParallelism = fleet.Parallelism
+	}
+	if o.fleetParallelism < 0 {
+		return fmt.Errorf("--fleet-parallelism must not be negative")
+	}
+	if o.fleetParallelism == 0 {
+		o.fleetParallelism = 1
+	}
+	return nil
+}
+
+// targets lists the clusters a run goes against: the --fleet's, or else one
+// per kubeconfig context.
+func (o *options) targets() []target {
+	var targets []target
+	if o.fleet != "" {
+		for _, cluster := range o.fleets[o.fleet].Clusters {
+			name := cluster.Name
+			if name == "" {
+				name = cluster.Context
+			}
+			targets = append(targets, target{name: name, kubeconfig: cluster.Kubeconfig, context: cluster.Context, concurrency: cluster.Concurrency})
+		}
+		return targets
+	}
+
+	contexts := o.contexts
+	if len(contexts) == 0 {
+		contexts = []string{o.context}
+	}
+	for _, kubeContext := range contexts {
+		targets = append(targets, target{name: kubeContext, context: kubeContext})
+	}
+	return targets
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func (o *options) withLeaderElection(ctx context.Context, run func(ctx context.Context) error) error {
+	if !o.leaderElect {
+		return run(ctx)
+	}
+
+	config, namespace, err := loadConfig(o.clientFlags())
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	if o.leaderElectionNamespace != "" {
+		namespace = o.leaderElectionNamespace
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: o.leaderElectionID, Namespace: namespace},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var runErr error
+	lost := false
+	slog.Info("Waiting for leadership", "lease", namespace+"/"+o.leaderElectionID, "identity", identity)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Name:            o.leaderElectionID,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				slog.Info("Acquired leadership", "identity", identity)
+				runErr = run(ctx)
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					lost = true
+				}
+			},
+		},
+	})
+
+	if lost {
+		return fmt.Errorf("lost leadership of lease %s/%s", namespace, o.leaderElectionID)
+	}
+	return runErr
+}
@@ -2,135 +2,154 @@ package main
 
 import (
 	"context"
-	"flag"
-	"fmt"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
-	"os"
 
-	corev1 "k8s.io/api/core/v1"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
 )
 
-func main() {
-	kubeconfig := getKubeconfig()
-	clientset, err := getClientset(kubeconfig)
-	if err != nil {
-		panic(err.Error())
-	}
+const (
+	exitFailure        = 1
+	exitNoMatch        = 2
+	exitPartialFailure = 3
+	exitAllFailed      = 4
+)
 
-	pods, err := listPods(clientset)
-	if err != nil {
-		panic(err.Error())
-	}
+type exitError struct {
+	code int
+	err  error
+}
 
-	restartDatabasePods(clientset, pods)
+func (e *exitError) Error() string {
+	return e.err.Error()
 }
 
-func getKubeconfig() string {
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
+func (e *exitError) Unwrap() error {
+	return e.err
+}
 
-	if _, err := os.Stat(*kubeconfig); os.IsNotExist(err) {
-		fmt.Printf("Kubeconfig file not found: %s\n", *kubeconfig)
-		os.Exit(1)
+func exitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
 	}
-
-	return *kubeconfig
+	return exitFailure
 }
 
-func getClientset(kubeconfig string) (*kubernetes.Clientset, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// A second signal kills the process instead of waiting for a clean stop.
+	context.AfterFunc(ctx, stop)
+
+	ctx, shutdownTracing, err := setupTracing(ctx)
 	if err != nil {
-		return nil, err
+		slog.Warn("Tracing disabled, could not set up the OTLP exporter", "error", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	cmd := newRootCommand()
+	if plugin, ok := strings.CutPrefix(filepath.Base(os.Args[0]), "kubectl-"); ok {
+		asPlugin(cmd, plugin, os.Args[1:])
+	}
+	err = cmd.ExecuteContext(ctx)
+	stop()
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Could not export traces", "error", err)
+	}
+	cancel()
 	if err != nil {
-		return nil, err
+		os.Exit(exitCode(err))
 	}
-
-	return clientset, nil
 }
 
-func listPods(clientset *kubernetes.Clientset) (*corev1.PodList, error) {
-	pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{})
+// asPlugin makes cmd present itself as the kubectl plugin kubectl runs when
+// this binary is installed as kubectl-restart_db, and makes a plugin
+// invocation without a subcommand, e.g. kubectl restart-db -l app=postgres,
+// a restart.
+func asPlugin(cmd *cobra.Command, plugin string, args []string) {
+	name := strings.ReplaceAll(strings.TrimSuffix(plugin, ".exe"), "_", "-")
+	cmd.Annotations = map[string]string{cobra.CommandDisplayNameAnnotation: "kubectl " + name}
+
+	isHelp := func(arg string) bool { return arg == "-h" || arg == "--help" }
+	if len(args) == 0 || slices.ContainsFunc(args, isHelp) {
+		return
+	}
+	restart, _, err := cmd.Find([]string{"restart"})
 	if err != nil {
-		return nil, err
+		return
+	}
+	// Flags of other subcommands are not known here, which is fine as
+	// anything left unparsed falls to restart to reject.
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.AddFlagSet(cmd.PersistentFlags())
+	flags.AddFlagSet(restart.Flags())
+	if firstArg(args, flags) == "" {
+		cmd.SetArgs(append([]string{"restart"}, args...))
 	}
-
-	return pods, nil
 }
 
-func restartDatabasePods(clientset *kubernetes.Clientset, pods *corev1.PodList) {
-	for _, pod := range pods.Items {
-		if strings.Contains(pod.Name, "database") {
-			fmt.Printf("Restarting pod: %s\n", pod.Name)
-
-			if podOwner := metav1.GetControllerOf(&pod); podOwner != nil {
-				var err error
-				switch podOwner.Kind {
-				case "Deployment":
-					err = rolloutRestartDeployment(clientset, pod.Namespace, podOwner.Name)
-				case "StatefulSet":
-					err = rolloutRestartStatefulSet(clientset, pod.Namespace, podOwner.Name)
-				default:
-					fmt.Printf("Skipping %s: unsupported controller kind %s\n", pod.Name, podOwner.Kind)
-					continue
-				}
-				if err != nil {
-					fmt.Printf("Error restarting %s: %v\n", pod.Name, err)
-				}
-			} else {
-				fmt.Printf("Pod %s is not controlled by a deployment or statefulset\n", pod.Name)
-			}
+// firstArg returns the first argument that is neither a flag nor a flag's
+// value.
+func firstArg(args []string, flags *pflag.FlagSet) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		var flag *pflag.Flag
+		if name, ok := strings.CutPrefix(arg, "--"); ok {
+			flag = flags.Lookup(name)
+		} else if len(arg) == 2 {
+			flag = flags.ShorthandLookup(arg[1:])
+		}
+		if flag != nil && flag.NoOptDefVal == "" {
+			i++
 		}
 	}
+	return ""
 }
 
-func rolloutRestartDeployment(clientset *kubernetes.Clientset, namespace, name string) error {
-	deploymentsClient := clientset.AppsV1().Deployments(namespace)
-	deployment, err := deploymentsClient.Get(context.TODO(), name, metav1.GetOptions{})
+// loadConfig loads the client configuration the way kubectl does, falling
+// back to the in-cluster configuration when there is no kubeconfig.
+func loadConfig(flags *genericclioptions.ConfigFlags) (*rest.Config, string, error) {
+	clientConfig := flags.ToRawKubeConfigLoader()
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	if deployment.Spec.Template.Annotations == nil {
-		deployment.Spec.Template.Annotations = map[string]string{}
-	}
-	deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
-
-	_, err = deploymentsClient.Update(context.TODO(), deployment, metav1.UpdateOptions{})
-	return err
-}
-
-func rolloutRestartStatefulSet(clientset *kubernetes.Clientset, namespace, name string) error {
-	statefulSetsClient := clientset.AppsV1().StatefulSets(namespace)
-	statefulSet, err := statefulSetsClient.Get(context.TODO(), name, metav1.GetOptions{})
+	namespace, _, err := clientConfig.Namespace()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	if statefulSet.Spec.Template.Annotations == nil {
-		statefulSet.Spec.Template.Annotations = map[string]string{}
-	}
-	statefulSet.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
-
-	_, err = statefulSetsClient.Update(context.TODO(), statefulSet, metav1.UpdateOptions{})
-	return err
+	slog.Info("Using cluster", "context", *flags.Context, "server", config.Host, "namespace", namespace)
+	return config, namespace, nil
 }
 
-func homeDir() string {
-	if h := os.Getenv("HOME"); h != "" {
-		return h
+func resolveNamespaces(defaultNamespace string, opts *options) []string {
+	if opts.allNamespaces {
+		return []string{metav1.NamespaceAll}
+	}
+	if len(opts.namespaces) > 0 {
+		return opts.namespaces
 	}
-	return os.Getenv("USERPROFILE")
+	return []string{defaultNamespace}
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+func newNodeMaintenanceCommand(opts *options) *cobra.Command {
+	var uncordon bool
+	cmd := &cobra.Command{
+		Use:   "node-maintenance NODE",
+		Short: "Cordon a node and move the matching pods off it one at a time",
+		Long: `Cordon a node and move the matching pods off it one at a time.
+
+Unlike kubectl drain, only matching pods are moved, each one waits for its
+PodDisruptionBudgets and its replacement to become ready (and healthy, with
+--health-check) before the next, and a failure stops the run with the node
+still cordoned. DaemonSet pods are never moved. Without --namespace, pods in
+every namespace are considered.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			node := args[0]
+			if len(opts.contexts) > 1 || opts.fleet != "" {
+				return fmt.Errorf("node-maintenance can only run against a single context")
+			}
+			opts.nodes = []string{node}
+			opts.allNamespaces = len(opts.namespaces) == 0
+			daemonSets, _ := restarter.ParseWorkloadPattern("DaemonSet/*/*")
+			opts.exclusions = append(opts.exclusions, daemonSets)
+			return opts.run(cmd.Context(), func(ctx context.Context, opts *options) (*report, error) {
+				return runNodeMaintenance(ctx, opts, node, uncordon)
+			})
+		},
+	}
+	addRestartFlags(cmd, opts)
+	strategy := cmd.Flags().Lookup("strategy")
+	strategy.DefValue = "evict"
+	strategy.Value.Set("evict")
+	cmd.Flags().BoolVar(&uncordon, "uncordon", false, "uncordon the node again once every pod was moved successfully (a node that was already cordoned is left cordoned)")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "print the workloads whose pods would be moved without cordoning or changing anything")
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "cordon and move pods without asking for confirmation")
+	cmd.Flags().IntVar(&opts.drainSeconds, "drain-seconds", 0, "give each pod this long to drain connections and shut down instead of its terminationGracePeriodSeconds")
+	cmd.Flags().StringVar(&opts.healthCheck, "health-check", "", "check every ready pod of a workload after its pods were moved and stop on failure: an http(s) URL template (http://{{.IP}}:8080/healthz), tcp:PORT or exec:COMMAND")
+	cmd.Flags().StringVar(&opts.reason, "reason", "", "why the pods are being moved, recorded in the restart-tool/reason annotation (defaults to the node maintenance)")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "delete pods even when a PodDisruptionBudget currently allows no disruptions (has no effect with --strategy evict)")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for each pod to be replaced")
+	addDeadlineFlags(cmd, opts)
+	return cmd
+}
+
+func runNodeMaintenance(ctx context.Context, opts *options, node string, uncordon bool) (*report, error) {
+	if opts.reason == "" {
+		opts.reason = "maintenance of node " + node
+	}
+	opts.wait = true
+	if opts.dryRun {
+		return runRestart(ctx, opts)
+	}
+
+	r, _, err := opts.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wasCordoned, err := r.Cordon(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("cordoning node %s: %w", node, err)
+	}
+
+	rep, err := runRestart(ctx, opts)
+	if err != nil && exitCode(err) != exitNoMatch {
+		slog.Error("Leaving node cordoned after a failure", "node", node)
+		return rep, err
+	}
+	if uncordon && !wasCordoned {
+		if err := r.Uncordon(context.WithoutCancel(ctx), node); err != nil {
+			return rep, fmt.Errorf("uncordoning node %s: %w", node, err)
+		}
+	}
+	return rep, err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 10 * time.Second
+
+func (o *options) notify(reports []*report) {
+	if o.notifyWebhook == "" || o.dryRun {
+		return
+	}
+
+	var payload any
+	switch o.notifyFormat {
+	case "template":
+		body, err := o.renderNotification(reports)
+		if err != nil {
+			slog.Warn("Could not render --notify-template", "error", err)
+			return
+		}
+		if err := postWebhookBody(o.notifyWebhook, body); err != nil {
+			slog.Warn("Could not send restart notification", "error", err)
+		}
+		return
+	case "slack":
+		text := slackSummary(reports)
+		if text == "" {
+			return
+		}
+		payload = map[string]string{"text": text}
+	case "json":
+		payload = reports
+	}
+
+	if err := postWebhook(o.notifyWebhook, payload); err != nil {
+		slog.Warn("Could not send restart notification", "error", err)
+	}
+}
+
+func slackSummary(reports []*report) string {
+	var b strings.Builder
+	for _, rep := range reports {
+		if len(rep.Workloads) == 0 && rep.Error == "" {
+			continue
+		}
+
+		succeeded, failed := 0, 0
+		for _, w := range rep.Workloads {
+			switch w.Result {
+			case "succeeded":
+				succeeded++
+			case "failed":
+				failed++
+			}
+		}
+
+		where := ""
+		if rep.Context != "" {
+			where = " in " + rep.Context
+		}
+		fmt.Fprintf(&b, "*Database restart%s*: %d succeeded, %d failed (%s)\n", where, succeeded, failed, rep.Duration)
+		if rep.Error != "" {
+			fmt.Fprintf(&b, "> %s\n", rep.Error)
+		}
+		for _, w := range rep.Workloads {
+			switch w.Result {
+			case "succeeded":
+				fmt.Fprintf(&b, "• %s restarted in %s\n", w, w.Duration)
+			case "failed":
+				fmt.Fprintf(&b, "• %s failed after %s: %s\n", w, w.Duration, w.Error)
+			case "rolled back":
+				fmt.Fprintf(&b, "• %s restarted in %s, then rolled back\n", w, w.Duration)
+			}
+		}
+	}
+	return b.String()
+}
+
+// notifyData is what --notify-template is executed with.
+type notifyData struct {
+	Reports   []*report
+	RunID     string
+	Initiator string
+	Summary   string
+}
+
+func (o *options) renderNotification(reports []*report) ([]byte, error) {
+	data := notifyData{Reports: reports, RunID: o.runID, Summary: slackSummary(reports)}
+	for _, rep := range reports {
+		if rep.Initiator != "" {
+			data.Initiator = rep.Initiator
+			break
+		}
+	}
+	var buf bytes.Buffer
+	if err := o.notifyTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toJSON lets templates quote values for a JSON payload.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func postWebhook(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postWebhookBody(url, body)
+}
+
+func postWebhookBody(url string, body []byte) error {
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+var (
+	restartPolicyResource = schema.GroupVersionResource{Group: "restart-tool.io", Version: "v1alpha1", Resource: "restartpolicies"}
+	restartPolicyKind     = restartPolicyResource.GroupVersion().WithKind("RestartPolicy")
+)
+
+type restartPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   restartPolicySpec   `json:"spec"`
+	Status restartPolicyStatus `json:"status"`
+}
+
+type restartPolicySpec struct {
+	Selector       string   `json:"selector,omitempty"`
+	Match          []string `json:"match,omitempty"`
+	Schedule       string   `json:"schedule"`
+	Window         string   `json:"window,omitempty"`
+	MaxUnavailable int      `json:"maxUnavailable,omitempty"`
+}
+
+type restartPolicyStatus struct {
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	LastResult       string       `json:"lastResult,omitempty"`
+	Message          string       `json:"message,omitempty"`
+}
+
+// policyOperator reconciles RestartPolicies, running each when its schedule
+// is due and requeueing it for its next scheduled time. It reconciles one
+// policy at a time, so lastRun needs no lock.
+type policyOperator struct {
+	client    client.Client
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	opts      *options
+	lastRun   map[types.UID]time.Time
+}
+
+func newOperatorCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "operator",
+		Short: "Run in-cluster and perform the restarts described by RestartPolicy resources",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOperator(cmd.Context(), opts)
+		},
+	}
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for each rollout")
+	cmd.Flags().DurationVar(&opts.resync, "resync", 30*time.Second, "how often to re-check every RestartPolicy, besides at its next scheduled time")
+	addLeaderElectionFlags(cmd, opts)
+	return cmd
+}
+
+func runOperator(ctx context.Context, opts *options) error {
+	config, _, err := loadConfig(opts.clientFlags())
+	if err != nil {
+		return err
+	}
+	opts.tuneConfig(config)
+
+	config = restarter.WithRetry(config, opts.retry, slog.Default())
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := restarter.New(clientset, dynamicClient, restarter.Options{}).Preflight(ctx, restartPolicyResource); err != nil {
+		return fmt.Errorf("pre-flight check against %s failed: %w", config.Host, err)
+	}
+
+	return opts.withLeaderElection(ctx, func(ctx context.Context) error {
+		return runPolicyOperator(ctx, config, clientset, dynamicClient, opts)
+	})
+}
+
+func runPolicyOperator(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, dynamicClient dynamic.Interface, opts *options) error {
+	ctrllog.SetLogger(logr.FromSlogHandler(slog.Default().Handler()))
+	cacheOpts := cache.Options{SyncPeriod: &opts.resync}
+	if len(opts.namespaces) > 0 {
+		cacheOpts.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range opts.namespaces {
+			cacheOpts.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+	mgr, err := manager.New(config, manager.Options{
+		Cache: cacheOpts,
+		// withLeaderElection already holds the Lease, and metrics are
+		// exported through OpenTelemetry.
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return err
+	}
+
+	op := &policyOperator{client: mgr.GetClient(), clientset: clientset, dynamic: dynamicClient, opts: opts, lastRun: map[types.UID]time.Time{}}
+	policy := &unstructured.Unstructured{}
+	policy.SetGroupVersionKind(restartPolicyKind)
+	c, err := controller.New("restartpolicy", mgr, controller.Options{Reconciler: op})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(source.Kind(mgr.GetCache(), policy, &handler.TypedEnqueueRequestForObject[*unstructured.Unstructured]{})); err != nil {
+		return err
+	}
+
+	slog.Info("Operator watching RestartPolicies", "namespaces", strings.Join(opts.namespaces, ","), "resync", opts.resync)
+	if err := mgr.Start(ctx); err != nil {
+		return err
+	}
+	slog.Info("Stopping operator")
+	return nil
+}
+
+// Reconcile runs the RestartPolicy named by req if its schedule is due.
+func (op *policyOperator) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(restartPolicyKind)
+	if err := op.client.Get(ctx, req.NamespacedName, obj); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	policy := &restartPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, policy); err != nil {
+		slog.Error("Could not decode RestartPolicy", "restartpolicy", req.String(), "error", err)
+		return reconcile.Result{}, nil
+	}
+	return op.reconcile(ctx, policy), nil
+}
+
+// reconcile runs policy if its schedule is due and returns when to look at it
+// again. An invalid schedule is only looked at again once the policy changes.
+func (op *policyOperator) reconcile(ctx context.Context, policy *restartPolicy) reconcile.Result {
+	log := slog.With("restartpolicy", policy.Namespace+"/"+policy.Name)
+	schedule, err := cron.ParseStandard(policy.Spec.Schedule)
+	if err != nil {
+		if policy.Status.LastResult != "Invalid" {
+			op.updateStatus(ctx, policy, nil, "Invalid", fmt.Sprintf("invalid schedule %q: %v", policy.Spec.Schedule, err))
+		}
+		return reconcile.Result{}
+	}
+
+	last := policy.CreationTimestamp.Time
+	if policy.Status.LastScheduleTime != nil {
+		last = policy.Status.LastScheduleTime.Time
+	}
+	// The informer cache can lag behind our own status updates.
+	if ran, ok := op.lastRun[policy.UID]; ok && ran.After(last) {
+		last = ran
+	}
+	now := time.Now()
+	if next := schedule.Next(last); next.After(now) {
+		return requeueAt(next)
+	}
+
+	if policy.Spec.Window != "" {
+		window, err := parseWindow(policy.Spec.Window)
+		if err != nil {
+			op.updateStatus(ctx, policy, &now, "Invalid", err.Error())
+			return reconcile.Result{}
+		}
+		if !window.contains(now) {
+			log.Info("Skipping scheduled restart outside the maintenance window", "window", policy.Spec.Window)
+			op.updateStatus(ctx, policy, &now, "Skipped", "scheduled run fell outside the maintenance window "+policy.Spec.Window)
+			return requeueAt(schedule.Next(now))
+		}
+	}
+
+	op.lastRun[policy.UID] = now
+	result, message := op.run(ctx, policy, log)
+	log.Info("Scheduled restart finished", "result", result, "message", message)
+	// Record the run even when shutting down, so it is not repeated on startup.
+	op.updateStatus(context.WithoutCancel(ctx), policy, &now, result, message)
+	return requeueAt(schedule.Next(now))
+}
+
+// requeueAt looks at a policy again at next, or at once if a run overran it.
+func requeueAt(next time.Time) reconcile.Result {
+	if wait := time.Until(next); wait > 0 {
+		return reconcile.Result{RequeueAfter: wait}
+	}
+	return reconcile.Result{Requeue: true}
+}
+
+func (op *policyOperator) run(ctx context.Context, policy *restartPolicy, log *slog.Logger) (string, string) {
+	match := policy.Spec.Match
+	if len(match) == 0 && policy.Spec.Selector == "" {
+		match = []string{"*database*"}
+	}
+	var patterns []restarter.NamePattern
+	for _, raw := range match {
+		pattern, err := restarter.ParseNamePattern(raw)
+		if err != nil {
+			return "Invalid", err.Error()
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	batchSize := policy.Spec.MaxUnavailable
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	r := restarter.New(op.clientset, op.dynamic, restarter.Options{
+		Selector:          policy.Spec.Selector,
+		Patterns:          patterns,
+		ExcludeNamespaces: op.opts.excludeNamespaces,
+		Exclude:           op.opts.exclusions,
+		Wait:              true,
+		Timeout:           op.opts.timeout,
+		BatchSize:         batchSize,
+		Reason:            fmt.Sprintf("scheduled by RestartPolicy %s/%s (%s)", policy.Namespace, policy.Name, policy.Spec.Schedule),
+		Logger:            log,
+	})
+
+	pods, err := r.ListPods(ctx, []string{policy.Namespace})
+	if err != nil {
+		return "Failed", err.Error()
+	}
+	plan, _ := r.Plan(ctx, pods)
+	if len(plan) == 0 {
+		return "NoMatch", "no workloads matched"
+	}
+
+	failed := r.RestartAll(ctx, plan)
+	if len(failed) > 0 {
+		var names []string
+		for _, w := range failed {
+			names = append(names, w.String())
+		}
+		return "Failed", fmt.Sprintf("%d of %d workload restart(s) failed: %s", len(failed), len(plan), strings.Join(names, ", "))
+	}
+	return "Succeeded", fmt.Sprintf("restarted %d workload(s)", len(plan))
+}
+
+func (op *policyOperator) updateStatus(ctx context.Context, policy *restartPolicy, scheduled *time.Time, result, message string) {
+	if scheduled != nil {
+		policy.Status.LastScheduleTime = &metav1.Time{Time: *scheduled}
+	}
+	policy.Status.LastResult = result
+	policy.Status.Message = message
+
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&policy.Status)
+	if err != nil {
+		slog.Error("Could not encode RestartPolicy status", "restartpolicy", policy.Namespace+"/"+policy.Name, "error", err)
+		return
+	}
+	client := op.dynamic.Resource(restartPolicyResource).Namespace(policy.Namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.Get(ctx, policy.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		latest.Object["status"] = status
+		_, err = client.UpdateStatus(ctx, latest, metav1.UpdateOptions{FieldManager: restarter.FieldManager})
+		return err
+	})
+	if err != nil {
+		slog.Error("Could not update RestartPolicy status", "restartpolicy", policy.Namespace+"/"+policy.Name, "error", err)
+	}
+}
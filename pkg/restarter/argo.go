@@ -0,0 +1,54 @@
+package restarter
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var argoRolloutsResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+// restartArgoRollout records the audit annotations on the Rollout itself,
+// since changing its pod template would start a new revision on top of the
+// in-place restart.
+func (r *Restarter) restartArgoRollout(ctx context.Context, namespace, name string, audit map[string]string) error {
+	annotations := map[string]any{}
+	for k, v := range audit {
+		annotations[k] = v
+	}
+	rollout := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": argoRolloutsResource.GroupVersion().String(),
+		"kind":       "Rollout",
+		"metadata": map[string]any{
+			"name":        name,
+			"namespace":   namespace,
+			"annotations": annotations,
+		},
+		"spec": map[string]any{
+			"restartAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	}}
+
+	_, err := r.dynamic.Resource(argoRolloutsResource).Namespace(namespace).Apply(ctx, name, rollout, applyOptions)
+	return err
+}
+
+func argoRolloutStatus(rollout *unstructured.Unstructured) *RolloutStatus {
+	s := &RolloutStatus{Desired: 1}
+	if replicas, found, _ := unstructured.NestedInt64(rollout.Object, "spec", "replicas"); found {
+		s.Desired = int32(replicas)
+	}
+	if updated, found, _ := unstructured.NestedInt64(rollout.Object, "status", "updatedReplicas"); found {
+		s.Updated = int32(updated)
+	}
+	if ready, found, _ := unstructured.NestedInt64(rollout.Object, "status", "readyReplicas"); found {
+		s.Ready = int32(ready)
+	}
+	_, pendingRestart, _ := unstructured.NestedString(rollout.Object, "spec", "restartAt")
+	restartedAt, _, _ := unstructured.NestedString(rollout.Object, "status", "restartedAt")
+	phase, _, _ := unstructured.NestedString(rollout.Object, "status", "phase")
+	s.Complete = phase == "Healthy" && s.Updated >= s.Desired && (!pendingRestart || restartedAt != "")
+	return s
+}
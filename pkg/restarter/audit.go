@@ -0,0 +1,97 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// auditLogRecords is how many records an audit log ConfigMap keeps; older
+// ones are dropped, keeping it well within the ConfigMap size limit.
+const auditLogRecords = 200
+
+// RestartRecord is one entry of the audit log: who restarted what, when,
+// why and how it went.
+type RestartRecord struct {
+	Time      time.Time `json:"time"`
+	Initiator string    `json:"initiator"`
+	RunID     string    `json:"runId"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+	Reason    string    `json:"reason"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+}
+
+// recordAudit appends the outcome of w's restart to the AuditLog ConfigMap
+// of its namespace, creating it if needed. Each record is a key named after
+// its time and workload, so the keys sort oldest first.
+func (r *Restarter) recordAudit(ctx context.Context, w *Workload, start time.Time) {
+	record := RestartRecord{
+		Time:      start.UTC(),
+		Initiator: r.initiator(ctx),
+		RunID:     r.opts.RunID,
+		Kind:      w.Kind,
+		Name:      w.Name,
+		Action:    w.Action,
+		Reason:    r.auditAnnotations(ctx, w)[reasonAnnotation],
+		Result:    w.Result,
+		Error:     w.Error,
+		Duration:  w.Duration,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		r.log.Warn("Could not record restart in the audit log", "workload", w.String(), "error", err)
+		return
+	}
+	key := record.Time.Format("20060102T150405.000000000Z") + "." + strings.ToLower(w.Kind) + "." + w.Name
+
+	configMaps := r.clientset.CoreV1().ConfigMaps(w.Namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, r.opts.AuditLog, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      r.opts.AuditLog,
+				Namespace: w.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": FieldManager},
+			}}
+			configMap.Data = map[string]string{key: string(data)}
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{FieldManager: FieldManager})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), r.opts.AuditLog, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[key] = string(data)
+		if len(configMap.Data) > auditLogRecords {
+			keys := make([]string, 0, len(configMap.Data))
+			for k := range configMap.Data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys[:len(keys)-auditLogRecords] {
+				delete(configMap.Data, k)
+			}
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		r.log.Warn("Could not record restart in the audit log", "workload", w.String(), "configMap", w.Namespace+"/"+r.opts.AuditLog, "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const crunchyBackupAnnotation = "postgres-operator.crunchydata.com/pgbackrest-backup"
+
+var (
+	veleroBackupResource        = schema.GroupVersionResource{Group: "velero.io", Version: "v1", Resource: "backups"}
+	perconaXtraDBBackupResource = schema.GroupVersionResource{Group: "pxc.percona.com", Version: "v1", Resource: "perconaxtradbclusterbackups"}
+	mysqlBackupResource         = schema.GroupVersionResource{Group: "mysql.oracle.com", Version: "v2", Resource: "mysqlbackups"}
+)
+
+// backup takes the backup configured by Options.Backup before w is
+// restarted. Velero backups cover the whole namespace and are taken once per
+// namespace per Restarter.
+func (r *Restarter) backup(ctx context.Context, w *Workload) error {
+	switch r.opts.Backup {
+	case "velero":
+		r.backupsMu.Lock()
+		defer r.backupsMu.Unlock()
+		if err, ok := r.backups[w.Namespace]; ok {
+			return err
+		}
+		err := r.veleroBackup(ctx, w.Namespace)
+		r.backups[w.Namespace] = err
+		return err
+	case "operator":
+		switch w.Kind {
+		case "PostgresCluster":
+			return r.crunchyBackup(ctx, w)
+		case "PerconaXtraDBCluster":
+			return r.createBackup(ctx, w, perconaXtraDBBackupResource, "PerconaXtraDBClusterBackup", map[string]any{
+				"pxcCluster":  w.Name,
+				"storageName": r.opts.BackupStorage,
+			}, backupStateDone("state", "Succeeded", "Failed", "Error"))
+		case "InnoDBCluster":
+			spec := map[string]any{"clusterName": w.Name}
+			if r.opts.BackupStorage != "" {
+				spec["backupProfileName"] = r.opts.BackupStorage
+			}
+			return r.createBackup(ctx, w, mysqlBackupResource, "MySQLBackup", spec, backupStateDone("status", "Completed", "Error", "Failed"))
+		default:
+			return fmt.Errorf("no operator backup is supported for %s", w.Kind)
+		}
+	}
+	return nil
+}
+
+func (r *Restarter) veleroBackup(ctx context.Context, namespace string) error {
+	backup := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": veleroBackupResource.GroupVersion().String(),
+		"kind":       "Backup",
+		"metadata": map[string]any{
+			"generateName": "restart-" + namespace + "-",
+			"namespace":    r.opts.VeleroNamespace,
+			"labels":       map[string]any{runIDAnnotation: r.opts.RunID},
+		},
+		"spec": map[string]any{
+			"includedNamespaces": []any{namespace},
+		},
+	}}
+	client := r.dynamic.Resource(veleroBackupResource).Namespace(r.opts.VeleroNamespace)
+	created, err := client.Create(ctx, backup, metav1.CreateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("creating velero backup: %w", err)
+	}
+	r.log.Info("Waiting for velero backup", "backup", r.opts.VeleroNamespace+"/"+created.GetName(), "namespace", namespace)
+	return r.waitForBackup(ctx, veleroBackupResource, r.opts.VeleroNamespace, created.GetName(), backupStateDone("phase", "Completed", "Failed", "PartiallyFailed", "FailedValidation"))
+}
+
+// crunchyBackup triggers the manual pgBackRest backup configured in the
+// cluster's spec.backups.pgbackrest.manual, as PGO documents. A merge patch is
+// used because applying only the backup annotation under FieldManager would
+// drop the restarted annotation a previous restart applied, and PGO would roll
+// the cluster.
+func (r *Restarter) crunchyBackup(ctx context.Context, w *Workload) error {
+	id := time.Now().UTC().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{crunchyBackupAnnotation: id}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.dynamic.Resource(crunchyPostgresResource).Namespace(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("triggering pgbackrest backup: %w", err)
+	}
+	r.log.Info("Waiting for pgbackrest backup", "workload", w.String())
+	return r.waitForBackup(ctx, crunchyPostgresResource, w.Namespace, w.Name, func(cluster *unstructured.Unstructured) (bool, error) {
+		manual, _, _ := unstructured.NestedMap(cluster.Object, "status", "pgbackrest", "manualBackup")
+		if manual["name"] != id || manual["finished"] != true {
+			return false, nil
+		}
+		if succeeded, _, _ := unstructured.NestedInt64(manual, "succeeded"); succeeded == 0 {
+			return false, fmt.Errorf("pgbackrest backup of %s failed", w)
+		}
+		return true, nil
+	})
+}
+
+func (r *Restarter) createBackup(ctx context.Context, w *Workload, resource schema.GroupVersionResource, kind string, spec map[string]any, done func(*unstructured.Unstructured) (bool, error)) error {
+	backup := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": resource.GroupVersion().String(),
+		"kind":       kind,
+		"metadata": map[string]any{
+			"generateName": w.Name + "-restart-",
+			"namespace":    w.Namespace,
+			"labels":       map[string]any{runIDAnnotation: r.opts.RunID},
+		},
+		"spec": spec,
+	}}
+	created, err := r.dynamic.Resource(resource).Namespace(w.Namespace).Create(ctx, backup, metav1.CreateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", kind, err)
+	}
+	r.log.Info("Waiting for backup", "workload", w.String(), "backup", kind+" "+w.Namespace+"/"+created.GetName())
+	return r.waitForBackup(ctx, resource, w.Namespace, created.GetName(), done)
+}
+
+// backupStateDone reports a backup as done once status.<field> is success,
+// and as failed once it is any of failures.
+func backupStateDone(field, success string, failures ...string) func(*unstructured.Unstructured) (bool, error) {
+	return func(backup *unstructured.Unstructured) (bool, error) {
+		state, _, _ := unstructured.NestedString(backup.Object, "status", field)
+		for _, failure := range failures {
+			if state == failure {
+				return false, fmt.Errorf("backup %s/%s finished with %s %s", backup.GetNamespace(), backup.GetName(), field, state)
+			}
+		}
+		return state == success, nil
+	}
+}
+
+func (r *Restarter) waitForBackup(ctx context.Context, resource schema.GroupVersionResource, namespace, name string, done func(*unstructured.Unstructured) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.BackupTimeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		backup, err := r.dynamic.Resource(resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return done(backup)
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for backup %s/%s", r.opts.BackupTimeout, namespace, name)
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheResync is how often the informers of a Cache replay their contents.
+const cacheResync = 10 * time.Minute
+
+// Cache keeps the pods, ReplicaSets, Deployments and StatefulSets of a
+// namespace, or of the whole cluster, up to date through shared informers,
+// so long-running processes such as watch and serve read them locally
+// instead of listing them from the API server on every run. Rollout status
+// is always read from the API server, since a cache that has not caught up
+// with a restart would report the previous rollout as complete.
+type Cache struct {
+	namespace    string
+	podInformer  cache.SharedIndexInformer
+	pods         corelisters.PodLister
+	replicaSets  appslisters.ReplicaSetLister
+	deployments  appslisters.DeploymentLister
+	statefulSets appslisters.StatefulSetLister
+}
+
+// NewCache starts informers on clientset for namespace, or every namespace
+// when it is empty, and waits for them to sync. They stop with ctx.
+func NewCache(ctx context.Context, clientset kubernetes.Interface, namespace string) (*Cache, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, cacheResync, informers.WithNamespace(namespace))
+	c := &Cache{
+		namespace:    namespace,
+		podInformer:  factory.Core().V1().Pods().Informer(),
+		pods:         factory.Core().V1().Pods().Lister(),
+		replicaSets:  factory.Apps().V1().ReplicaSets().Lister(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+	}
+	factory.Start(ctx.Done())
+	for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("failed to sync %v informer", typ)
+		}
+	}
+	return c, nil
+}
+
+// covers reports whether c holds the objects of namespace.
+func (c *Cache) covers(namespace string) bool {
+	return c != nil && (c.namespace == metav1.NamespaceAll || c.namespace == namespace)
+}
+
+func (c *Cache) listPods(namespace string, selector labels.Selector) ([]*corev1.Pod, error) {
+	if namespace == metav1.NamespaceAll {
+		return c.pods.List(selector)
+	}
+	return c.pods.Pods(namespace).List(selector)
+}
+
+// cached returns the object get finds in the cache, or lookup's when the
+// cache does not have it yet, as when it was only just created.
+func cached[T any](get func() (T, error), lookup func() (T, error)) (T, error) {
+	obj, err := get()
+	if apierrors.IsNotFound(err) {
+		return lookup()
+	}
+	return obj, err
+}
+
+func getReplicaSet(ctx context.Context, clientset kubernetes.Interface, c *Cache, namespace, name string) (*appsv1.ReplicaSet, error) {
+	lookup := func() (*appsv1.ReplicaSet, error) {
+		return clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	if !c.covers(namespace) {
+		return lookup()
+	}
+	return cached(func() (*appsv1.ReplicaSet, error) { return c.replicaSets.ReplicaSets(namespace).Get(name) }, lookup)
+}
+
+func getDeployment(ctx context.Context, clientset kubernetes.Interface, c *Cache, namespace, name string) (*appsv1.Deployment, error) {
+	lookup := func() (*appsv1.Deployment, error) {
+		return clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	if !c.covers(namespace) {
+		return lookup()
+	}
+	return cached(func() (*appsv1.Deployment, error) { return c.deployments.Deployments(namespace).Get(name) }, lookup)
+}
+
+func getStatefulSet(ctx context.Context, clientset kubernetes.Interface, c *Cache, namespace, name string) (*appsv1.StatefulSet, error) {
+	lookup := func() (*appsv1.StatefulSet, error) {
+		return clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	if !c.covers(namespace) {
+		return lookup()
+	}
+	return cached(func() (*appsv1.StatefulSet, error) { return c.statefulSets.StatefulSets(namespace).Get(name) }, lookup)
+}
+
+// listCachedPods adds the matching pods of namespace in r's Cache to pods.
+func (r *Restarter) listCachedPods(namespace string, pods *corev1.PodList) error {
+	selector, err := labels.Parse(r.labelSelector())
+	if err != nil {
+		return err
+	}
+	list, err := r.opts.Cache.listPods(namespace, selector)
+	if err != nil {
+		return err
+	}
+	for _, pod := range list {
+		if _, ok := r.MatchPod(pod); !ok {
+			r.log.Debug("Pod did not match", "pod", pod.Namespace+"/"+pod.Name)
+			continue
+		}
+		// The cache's pods are shared and must not be modified.
+		p := *pod
+		p.ManagedFields = nil
+		pods.Items = append(pods.Items, p)
+	}
+	return nil
+}
+
+// UseCache makes r read from c as if it had been given as Options.Cache, for
+// a cache started once r has checked it can reach the cluster. It must be
+// called before r is used.
+func (r *Restarter) UseCache(c *Cache) {
+	r.opts.Cache = c
+}
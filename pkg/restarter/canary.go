@@ -0,0 +1,67 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// canaryApplies reports whether w is restarted by a rollout Canary can precede.
+func canaryApplies(w *Workload) bool {
+	if w.Action != "restart" {
+		return false
+	}
+	switch w.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		return true
+	}
+	return false
+}
+
+// restartCanary replaces a single matching pod of w and waits for its
+// replacement to become ready and pass the health check, so a pod that cannot
+// come back fails the workload before the rest of its pods are touched.
+func (r *Restarter) restartCanary(ctx context.Context, w *Workload) error {
+	status, err := r.RolloutStatus(ctx, w.Kind, w.Namespace, w.Name)
+	if err != nil {
+		return err
+	}
+	if status.Desired <= 1 {
+		r.log.Info("Skipping canary, workload has a single replica", "workload", w.String())
+		return nil
+	}
+
+	for _, name := range w.Pods {
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		r.log.Info("Deleting canary pod", "workload", w.String(), "pod", w.Namespace+"/"+name)
+		err = r.clientset.CoreV1().Pods(w.Namespace).Delete(ctx, name, r.podDeleteOptions(pod))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := r.waitForPodGone(ctx, w.Namespace, name, pod.UID, r.opts.Timeout+r.opts.DrainPeriod); err != nil {
+			return fmt.Errorf("canary: %w", err)
+		}
+		if err := r.waitForReplicasReady(ctx, w, r.opts.Timeout); err != nil {
+			return fmt.Errorf("canary: %w", err)
+		}
+		if r.opts.HealthCheck != nil {
+			if err := r.verifyPods(ctx, w, "canary health check", r.opts.HealthCheck.Check, r.opts.Timeout, start); err != nil {
+				return err
+			}
+		}
+		r.log.Info("Canary pod is healthy, restarting the rest", "workload", w.String())
+		return nil
+	}
+	return fmt.Errorf("canary: none of the matching pods of %s exist anymore", w)
+}
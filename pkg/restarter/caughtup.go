@@ -0,0 +1,92 @@
+package restarter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+// ParseCaughtUpCheck parses exec:COMMAND, a whitespace separated command
+// run in the pod's first container that succeeds once the replica has
+// caught up, or promql:QUERY OP THRESHOLD, a PromQL condition queried from
+// prometheusURL whose query is a template with the pod's .Name, .Namespace
+// and .IP, e.g. promql:pg_replication_lag_seconds{pod="{{.Name}}"} < 5.
+func ParseCaughtUpCheck(spec string, config *rest.Config, prometheusURL string, client *http.Client) (HealthCheck, error) {
+	switch {
+	case strings.HasPrefix(spec, "exec:"):
+		return ParseHealthCheck(spec, config)
+	case strings.HasPrefix(spec, "promql:"):
+		if prometheusURL == "" {
+			return nil, fmt.Errorf("a promql: caught-up check needs a Prometheus URL")
+		}
+		gate, err := ParsePromQLGate(strings.TrimPrefix(spec, "promql:"))
+		if err != nil {
+			return nil, err
+		}
+		gate.Server, gate.Client = prometheusURL, client
+		return promQLCheck{gate}, nil
+	default:
+		return nil, fmt.Errorf("invalid caught-up check %q: must start with exec: or promql:", spec)
+	}
+}
+
+type promQLCheck struct {
+	gate *PromQLGate
+}
+
+func (c promQLCheck) Check(ctx context.Context, pod *corev1.Pod) error {
+	var query strings.Builder
+	if err := c.gate.Query.Execute(&query, healthCheckTarget{Name: pod.Name, Namespace: pod.Namespace, IP: pod.Status.PodIP}); err != nil {
+		return err
+	}
+	reason, err := c.gate.evaluate(ctx, query.String())
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return errors.New(reason)
+	}
+	return nil
+}
+
+// waitForCaughtUp retries the CaughtUp check against a replaced
+// StatefulSet pod until it passes, so the next ordinal is only taken down
+// once this replica has resynced.
+func (r *Restarter) waitForCaughtUp(ctx context.Context, namespace, name string) error {
+	if r.opts.CaughtUp == nil {
+		return nil
+	}
+	timeout := r.opts.CaughtUpTimeout
+	if timeout == 0 {
+		timeout = r.opts.Timeout
+	}
+	r.log.Info("Waiting for replica to catch up", "pod", namespace+"/"+name, "timeout", timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, healthCheckAttemptTimeout)
+		lastErr = r.opts.CaughtUp.Check(attemptCtx, pod)
+		cancel()
+		if lastErr != nil {
+			r.log.Debug("Replica has not caught up yet", "pod", namespace+"/"+name, "error", lastErr)
+		}
+		return lastErr == nil, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("pod %s/%s did not catch up after %s: %v", namespace, name, timeout, lastErr)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package restarter
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PodExpression is a CEL expression evaluated against a pod, available to it
+// as the variable pod with the fields of its JSON form.
+type PodExpression struct {
+	raw     string
+	program cel.Program
+}
+
+// ParsePodExpression compiles a CEL expression that must evaluate to a
+// bool, such as pod.metadata.labels['tier'] == 'db' &&
+// pod.status.containerStatuses.exists(c, c.restartCount > 3).
+func ParsePodExpression(raw string) (PodExpression, error) {
+	env, err := cel.NewEnv(cel.Variable("pod", cel.DynType))
+	if err != nil {
+		return PodExpression{}, err
+	}
+	ast, issues := env.Compile(raw)
+	if issues.Err() != nil {
+		return PodExpression{}, fmt.Errorf("invalid CEL expression %q: %w", raw, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return PodExpression{}, fmt.Errorf("CEL expression %q must evaluate to a bool, not %s", raw, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return PodExpression{}, fmt.Errorf("invalid CEL expression %q: %w", raw, err)
+	}
+	return PodExpression{raw: raw, program: program}, nil
+}
+
+// matchExpressions reports whether pod satisfies every expression. An
+// expression that fails to evaluate, for example on a missing map key,
+// does not match.
+func (r *Restarter) matchExpressions(pod *corev1.Pod) (string, bool) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		r.log.Warn("Could not convert pod for CEL evaluation", "pod", pod.Namespace+"/"+pod.Name, "error", err)
+		return "", false
+	}
+	for _, e := range r.opts.Expressions {
+		out, _, err := e.program.Eval(map[string]any{"pod": obj})
+		if err != nil {
+			r.log.Debug("CEL expression did not evaluate", "pod", pod.Namespace+"/"+pod.Name, "expression", e.raw, "error", err)
+			return "", false
+		}
+		if matched, ok := out.Value().(bool); !ok || !matched {
+			return "", false
+		}
+	}
+	if len(r.opts.Expressions) == 1 {
+		return fmt.Sprintf("matches CEL %q", r.opts.Expressions[0].raw), true
+	}
+	return fmt.Sprintf("matches %d CEL expressions", len(r.opts.Expressions)), true
+}
@@ -0,0 +1,99 @@
+package restarter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const configHashAnnotation = "restart-tool/config-hash"
+
+// ConfigRef names a ConfigMap or Secret in each workload's namespace whose
+// contents decide whether the workload needs a restart.
+type ConfigRef struct {
+	Kind string
+	Name string
+}
+
+// ParseConfigRef parses configmap/NAME or secret/NAME.
+func ParseConfigRef(raw string) (ConfigRef, error) {
+	kind, name, ok := strings.Cut(raw, "/")
+	if !ok || name == "" {
+		return ConfigRef{}, fmt.Errorf("invalid config reference %q: must be configmap/NAME or secret/NAME", raw)
+	}
+	switch strings.ToLower(kind) {
+	case "configmap", "cm":
+		return ConfigRef{Kind: "ConfigMap", Name: name}, nil
+	case "secret":
+		return ConfigRef{Kind: "Secret", Name: name}, nil
+	default:
+		return ConfigRef{}, fmt.Errorf("invalid config reference %q: kind must be configmap or secret", raw)
+	}
+}
+
+// configHash hashes the data of the IfChanged ConfigMaps and Secrets in
+// namespace, so it changes whenever any of their keys or values do.
+func (r *Restarter) configHash(ctx context.Context, namespace string) (string, error) {
+	hash := sha256.New()
+	for _, ref := range r.opts.IfChanged {
+		data := map[string][]byte{}
+		switch ref.Kind {
+		case "ConfigMap":
+			configMap, err := r.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			for k, v := range configMap.Data {
+				data[k] = []byte(v)
+			}
+			for k, v := range configMap.BinaryData {
+				data[k] = v
+			}
+		case "Secret":
+			secret, err := r.clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			data = secret.Data
+		}
+
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(hash, "%s/%s\n", ref.Kind, ref.Name)
+		for _, k := range keys {
+			fmt.Fprintf(hash, "%s=%d:%s\n", k, len(data[k]), data[k])
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordConfigHash stores the hash the workload was restarted for in its
+// annotations. A merge patch is used so the annotation is not tied to the
+// fields the restart applies.
+func (r *Restarter) recordConfigHash(ctx context.Context, w *Workload) error {
+	resource := operatorClusters[w.Kind].resource
+	if resource.Empty() {
+		var err error
+		if resource, err = r.customResource(w.apiVersion, w.Kind); err != nil {
+			return err
+		}
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{configHashAnnotation: w.configHash}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.dynamic.Resource(resource).Namespace(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	return err
+}
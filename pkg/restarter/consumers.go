@@ -0,0 +1,106 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// consumerReplicasAnnotation records the replicas of a scaled down consumer,
+// so a run that dies before scaling it back leaves them on the Deployment.
+const consumerReplicasAnnotation = "restart-tool/consumer-replicas"
+
+// Consumer names a Deployment that connects to the restarted databases.
+type Consumer struct {
+	Namespace string
+	Name      string
+}
+
+func (c Consumer) String() string {
+	return "Deployment " + c.Namespace + "/" + c.Name
+}
+
+// ParseConsumer parses NAMESPACE/NAME.
+func ParseConsumer(raw string) (Consumer, error) {
+	namespace, name, ok := strings.Cut(raw, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return Consumer{}, fmt.Errorf("invalid consumer %q: must be NAMESPACE/NAME", raw)
+	}
+	return Consumer{Namespace: namespace, Name: name}, nil
+}
+
+// pauseConsumers scales the Consumers to zero and waits for their pods to
+// stop, and returns a function that scales them back to their replicas. It
+// is returned even on error, to scale back the consumers already paused.
+func (r *Restarter) pauseConsumers(ctx context.Context) (func(), error) {
+	var paused []Consumer
+	replicas := map[Consumer]int32{}
+	resume := func() {
+		ctx := context.WithoutCancel(ctx)
+		for _, c := range paused {
+			r.log.Info("Scaling consumer back up", "consumer", c.String(), "replicas", replicas[c])
+			if err := r.scaleWorkload(ctx, "Deployment", c.Namespace, c.Name, replicas[c]); err != nil {
+				r.log.Error("Could not scale consumer back up, restore it from its "+consumerReplicasAnnotation+" annotation", "consumer", c.String(), "error", err)
+				continue
+			}
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, consumerReplicasAnnotation)
+			if _, err := r.clientset.AppsV1().Deployments(c.Namespace).Patch(ctx, c.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+				r.log.Warn("Could not remove the replicas annotation from consumer", "consumer", c.String(), "error", err)
+			}
+		}
+	}
+
+	for _, c := range r.opts.Consumers {
+		deployment, err := r.clientset.AppsV1().Deployments(c.Namespace).Get(ctx, c.Name, metav1.GetOptions{})
+		if err != nil {
+			return resume, fmt.Errorf("looking up consumer %s: %w", c, err)
+		}
+		// A consumer left scaled down by an earlier run keeps its recorded replicas.
+		n := int32(1)
+		if deployment.Spec.Replicas != nil {
+			n = *deployment.Spec.Replicas
+		}
+		if recorded, ok := deployment.Annotations[consumerReplicasAnnotation]; ok {
+			if parsed, err := strconv.ParseInt(recorded, 10, 32); err == nil {
+				n = int32(parsed)
+			}
+		}
+		if n == 0 {
+			r.log.Info("Consumer is already scaled to zero", "consumer", c.String())
+			continue
+		}
+
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, consumerReplicasAnnotation, strconv.Itoa(int(n)))
+		if _, err := r.clientset.AppsV1().Deployments(c.Namespace).Patch(ctx, c.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+			return resume, fmt.Errorf("recording the replicas of consumer %s: %w", c, err)
+		}
+		r.log.Info("Scaling consumer down", "consumer", c.String(), "replicas", n)
+		if err := r.scaleWorkload(ctx, "Deployment", c.Namespace, c.Name, 0); err != nil {
+			return resume, fmt.Errorf("scaling down consumer %s: %w", c, err)
+		}
+		paused = append(paused, c)
+		replicas[c] = n
+	}
+
+	for _, c := range paused {
+		err := wait.PollUntilContextTimeout(ctx, rolloutPollInterval, r.opts.Timeout, true, func(ctx context.Context) (bool, error) {
+			deployment, err := r.clientset.AppsV1().Deployments(c.Namespace).Get(ctx, c.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return deployment.Status.Replicas == 0, nil
+		})
+		if wait.Interrupted(err) {
+			return resume, fmt.Errorf("timed out after %s waiting for the pods of consumer %s to stop", r.opts.Timeout, c)
+		}
+		if err != nil {
+			return resume, err
+		}
+	}
+	return resume, nil
+}
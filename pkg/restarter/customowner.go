@@ -0,0 +1,142 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CustomOwner restarts workloads of a kind this package does not know, such
+// as a database operator's custom resource, by setting a field on it to the
+// current time and leaving the rollout to its operator.
+type CustomOwner struct {
+	Kind string
+	Path []string
+}
+
+// ParseCustomOwner parses KIND=PATH, where PATH is a dotted field path whose
+// segments may be bracketed to contain dots, e.g.
+// PerconaXtraDBCluster=metadata.annotations[restart-tool/restartedAt] or
+// Postgresql=spec.restartedAt.
+func ParseCustomOwner(raw string) (CustomOwner, error) {
+	kind, fieldPath, ok := strings.Cut(raw, "=")
+	if !ok || kind == "" || fieldPath == "" {
+		return CustomOwner{}, fmt.Errorf("invalid custom owner %q: must be KIND=FIELD.PATH", raw)
+	}
+	path, err := parseFieldPath(fieldPath)
+	if err != nil {
+		return CustomOwner{}, fmt.Errorf("invalid custom owner %q: %w", raw, err)
+	}
+	if path[0] != "metadata" && path[0] != "spec" {
+		return CustomOwner{}, fmt.Errorf("invalid custom owner %q: field must be under metadata or spec", raw)
+	}
+	return CustomOwner{Kind: kind, Path: path}, nil
+}
+
+func parseFieldPath(raw string) ([]string, error) {
+	var path []string
+	for raw != "" {
+		var segment string
+		if rest, ok := strings.CutPrefix(raw, "["); ok {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in field path")
+			}
+			segment, raw = rest[:end], rest[end+1:]
+		} else {
+			end := strings.IndexAny(raw, ".[")
+			if end < 0 {
+				end = len(raw)
+			}
+			segment, raw = raw[:end], raw[end:]
+		}
+		if segment == "" {
+			return nil, fmt.Errorf("empty segment in field path")
+		}
+		path = append(path, segment)
+		raw = strings.TrimPrefix(raw, ".")
+	}
+	if len(path) < 2 {
+		return nil, fmt.Errorf("field path must have at least two segments")
+	}
+	return path, nil
+}
+
+func (r *Restarter) customOwner(kind string) (CustomOwner, bool) {
+	for _, owner := range r.opts.CustomOwners {
+		if owner.Kind == kind {
+			return owner, true
+		}
+	}
+	return CustomOwner{}, false
+}
+
+func (r *Restarter) customKinds() map[string]bool {
+	kinds := map[string]bool{}
+	for _, owner := range r.opts.CustomOwners {
+		kinds[owner.Kind] = true
+	}
+	return kinds
+}
+
+// customResource finds the resource serving kind in apiVersion through discovery.
+func (r *Restarter) customResource(apiVersion, kind string) (schema.GroupVersionResource, error) {
+	r.resourcesMu.Lock()
+	defer r.resourcesMu.Unlock()
+	key := apiVersion + "/" + kind
+	if gvr, ok := r.resources[key]; ok {
+		return gvr, nil
+	}
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	list, err := r.clientset.Discovery().ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	for _, resource := range list.APIResources {
+		if resource.Kind == kind && !strings.Contains(resource.Name, "/") {
+			gvr := gv.WithResource(resource.Name)
+			r.resources[key] = gvr
+			return gvr, nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("no resource for %s in %s", kind, apiVersion)
+}
+
+func (r *Restarter) getCustomOwner(ctx context.Context, w *Workload) (*unstructured.Unstructured, error) {
+	gvr, err := r.customResource(w.apiVersion, w.Kind)
+	if err != nil {
+		return nil, err
+	}
+	return r.dynamic.Resource(gvr).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+}
+
+// restartCustomOwner applies the configured field, set to the current time,
+// together with the audit annotations.
+func (r *Restarter) restartCustomOwner(ctx context.Context, w *Workload, owner CustomOwner, audit map[string]string) error {
+	gvr, err := r.customResource(w.apiVersion, w.Kind)
+	if err != nil {
+		return err
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(w.apiVersion)
+	obj.SetKind(w.Kind)
+	obj.SetName(w.Name)
+	obj.SetNamespace(w.Namespace)
+	obj.SetAnnotations(audit)
+	if err := unstructured.SetNestedField(obj.Object, time.Now().UTC().Format(time.RFC3339), owner.Path...); err != nil {
+		return err
+	}
+
+	_, err = r.dynamic.Resource(gvr).Namespace(w.Namespace).Apply(ctx, w.Name, obj, applyOptions)
+	return err
+}
@@ -0,0 +1,63 @@
+package restarter
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCustomOwner(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    CustomOwner
+		wantErr bool
+	}{
+		{raw: "Postgresql=spec.restartedAt", want: CustomOwner{Kind: "Postgresql", Path: []string{"spec", "restartedAt"}}},
+		{
+			raw:  "PerconaXtraDBCluster=metadata.annotations[restart-tool/restartedAt]",
+			want: CustomOwner{Kind: "PerconaXtraDBCluster", Path: []string{"metadata", "annotations", "restart-tool/restartedAt"}},
+		},
+		{raw: "Postgresql", wantErr: true},
+		{raw: "=spec.restartedAt", wantErr: true},
+		{raw: "Postgresql=", wantErr: true},
+		{raw: "Postgresql=status.restartedAt", wantErr: true},
+		{raw: "Postgresql=spec", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCustomOwner(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCustomOwner(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got.Kind != tt.want.Kind || !slices.Equal(got.Path, tt.want.Path) {
+			t.Errorf("ParseCustomOwner(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseFieldPath(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []string
+		wantErr bool
+	}{
+		{raw: "spec.restartedAt", want: []string{"spec", "restartedAt"}},
+		{raw: "spec.template.metadata.annotations", want: []string{"spec", "template", "metadata", "annotations"}},
+		{raw: "metadata.annotations[example.com/restarted-at]", want: []string{"metadata", "annotations", "example.com/restarted-at"}},
+		{raw: "spec[pods].[restart.at]", want: []string{"spec", "pods", "restart.at"}},
+		{raw: "spec", wantErr: true},
+		{raw: "spec..restartedAt", wantErr: true},
+		{raw: "spec.restartedAt.", want: []string{"spec", "restartedAt"}},
+		{raw: "metadata.annotations[restarted", wantErr: true},
+		{raw: "metadata.annotations[]", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFieldPath(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFieldPath(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseFieldPath(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
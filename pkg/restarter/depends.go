@@ -0,0 +1,146 @@
+package restarter
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const dependsOnAnnotation = "restart-tool/depends-on"
+
+// ParseOrder parses a chain of workload patterns separated by >, such as
+// StatefulSet/prod/postgres>Deployment/prod/*, where workloads matching an
+// earlier pattern are restarted before those matching a later one.
+func ParseOrder(raw string) ([]WorkloadPattern, error) {
+	var chain []WorkloadPattern
+	for _, part := range strings.Split(raw, ">") {
+		p, err := ParseWorkloadPattern(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) < 2 {
+		return nil, fmt.Errorf("invalid order %q: needs at least two patterns separated by >", raw)
+	}
+	return chain, nil
+}
+
+// dependsOn reports whether the restart-tool/depends-on annotation value,
+// a comma-separated list of [KIND/]NAME globs in w's namespace, names u.
+func dependsOn(annotation string, w, u *Workload) bool {
+	if u.Namespace != w.Namespace {
+		return false
+	}
+	for _, ref := range strings.Split(annotation, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		kind, name := "*", ref
+		if k, n, ok := strings.Cut(ref, "/"); ok {
+			kind, name = strings.ToLower(k), n
+		}
+		kindMatched, _ := path.Match(kind, strings.ToLower(u.Kind))
+		nameMatched, _ := path.Match(name, u.Name)
+		if kindMatched && nameMatched {
+			return true
+		}
+	}
+	return false
+}
+
+// orderPlan works out which workloads of plan each one depends on, from
+// their depends-on annotations and the Order chains, and sorts plan so
+// dependencies come first. Workloads in a dependency cycle are skipped.
+func (r *Restarter) orderPlan(plan []*Workload, annotations map[*Workload]string) ([]*Workload, []SkippedPod) {
+	for _, w := range plan {
+		for _, u := range plan {
+			if u == w {
+				continue
+			}
+			if dependsOn(annotations[w], w, u) || r.orderedBefore(u, w) {
+				w.dependencies = append(w.dependencies, u)
+				w.DependsOn = append(w.DependsOn, u.String())
+				u.hasDependents = true
+			}
+		}
+	}
+
+	levels := map[*Workload]int{}
+	for progress := true; progress; {
+		progress = false
+		for _, w := range plan {
+			if _, done := levels[w]; done {
+				continue
+			}
+			level, ready := 0, true
+			for _, dep := range w.dependencies {
+				depLevel, done := levels[dep]
+				if !done {
+					ready = false
+					break
+				}
+				level = max(level, depLevel+1)
+			}
+			if ready {
+				levels[w] = level
+				progress = true
+			}
+		}
+	}
+
+	var ordered []*Workload
+	var skipped []SkippedPod
+	for _, w := range plan {
+		if _, ok := levels[w]; !ok {
+			r.log.Warn("Skipping workload in a dependency cycle", "workload", w.String(), "dependsOn", strings.Join(w.DependsOn, ","))
+			skipped = append(skipped, w.skipPods(SkippedDependencyCycle, "dependency cycle")...)
+			continue
+		}
+		w.level = levels[w]
+		ordered = append(ordered, w)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].level < ordered[j].level })
+	return ordered, skipped
+}
+
+func (r *Restarter) orderedBefore(u, w *Workload) bool {
+	for _, chain := range r.opts.Order {
+		for i, later := range chain {
+			if !later.matches(w) {
+				continue
+			}
+			for _, earlier := range chain[:i] {
+				if earlier.matches(u) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// dependencyLevels splits an ordered plan into the groups that can be
+// restarted together.
+func dependencyLevels(plan []*Workload) [][]*Workload {
+	var levels [][]*Workload
+	for _, w := range plan {
+		for len(levels) <= w.level {
+			levels = append(levels, nil)
+		}
+		levels[w.level] = append(levels[w.level], w)
+	}
+	return levels
+}
+
+// failedDependency returns the first dependency of w that did not restart.
+func failedDependency(w *Workload) *Workload {
+	for _, dep := range w.dependencies {
+		if dep.Result != "succeeded" {
+			return dep
+		}
+	}
+	return nil
+}
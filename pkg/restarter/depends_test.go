@@ -0,0 +1,78 @@
+package restarter
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+func TestOrderPlan(t *testing.T) {
+	tests := []struct {
+		name        string
+		order       []string
+		annotations map[string]string
+		want        []string
+		skipped     []string
+	}{
+		{
+			name: "unrelated workloads keep their order",
+			want: []string{"StatefulSet prod/postgres", "Deployment prod/api", "Deployment prod/worker"},
+		},
+		{
+			name:  "order chain",
+			order: []string{"Deployment/prod/api>StatefulSet/prod/postgres"},
+			want:  []string{"Deployment prod/api", "Deployment prod/worker", "StatefulSet prod/postgres"},
+		},
+		{
+			name:        "depends-on annotation",
+			annotations: map[string]string{"postgres": "Deployment/worker", "api": "postgres"},
+			want:        []string{"Deployment prod/worker", "StatefulSet prod/postgres", "Deployment prod/api"},
+		},
+		{
+			name:        "cycle is skipped",
+			annotations: map[string]string{"api": "worker", "worker": "api"},
+			want:        []string{"StatefulSet prod/postgres"},
+			skipped:     []string{"api-0", "worker-0"},
+		},
+	}
+	for _, tt := range tests {
+		var order [][]WorkloadPattern
+		for _, raw := range tt.order {
+			chain, err := ParseOrder(raw)
+			if err != nil {
+				t.Fatalf("%s: ParseOrder(%q): %v", tt.name, raw, err)
+			}
+			order = append(order, chain)
+		}
+		r := New(nil, nil, Options{Order: order, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+
+		plan := []*Workload{
+			{Kind: "StatefulSet", Namespace: "prod", Name: "postgres", Pods: []string{"postgres-0"}},
+			{Kind: "Deployment", Namespace: "prod", Name: "api", Pods: []string{"api-0"}},
+			{Kind: "Deployment", Namespace: "prod", Name: "worker", Pods: []string{"worker-0"}},
+		}
+		annotations := map[*Workload]string{}
+		for _, w := range plan {
+			annotations[w] = tt.annotations[w.Name]
+		}
+
+		ordered, skipped := r.orderPlan(plan, annotations)
+		var got, gotSkipped []string
+		for _, w := range ordered {
+			got = append(got, w.String())
+		}
+		for _, pod := range skipped {
+			if pod.Result != SkippedDependencyCycle {
+				t.Errorf("%s: pod %s skipped as %s, want %s", tt.name, pod.Name, pod.Result, SkippedDependencyCycle)
+			}
+			gotSkipped = append(gotSkipped, pod.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: orderPlan = %q, want %q", tt.name, got, tt.want)
+		}
+		if !slices.Equal(gotSkipped, tt.skipped) {
+			t.Errorf("%s: skipped %q, want %q", tt.name, gotSkipped, tt.skipped)
+		}
+	}
+}
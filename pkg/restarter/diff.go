@@ -0,0 +1,73 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// writesTemplate reports whether restarting w writes to its pod template,
+// rather than deleting, evicting or scaling its pods or going through an
+// operator, Argo CD or the Karmada control plane.
+func writesTemplate(w *Workload) bool {
+	if _, ok := templateResources[w.Kind]; !ok || w.propagated || w.argoCDApp != nil {
+		return false
+	}
+	return w.Action == "restart" || w.Action == "partitioned-restart" || w.onDelete
+}
+
+// Diff returns a unified diff, in the style of kubectl diff, between w as it
+// is in the cluster and w as a restart will write it: the restart
+// annotations on its pod template and, for a paused Deployment, its
+// temporary resume. It returns an empty string when the restart does not
+// change w's template.
+func (r *Restarter) Diff(ctx context.Context, w *Workload) (string, error) {
+	if !writesTemplate(w) {
+		return "", nil
+	}
+	obj, err := r.getWorkloadMeta(ctx, w)
+	if err != nil {
+		return "", err
+	}
+	live, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	before := &unstructured.Unstructured{Object: live}
+	before.SetAPIVersion(appsv1.SchemeGroupVersion.String())
+	before.SetKind(w.Kind)
+	before.SetManagedFields(nil)
+	after := before.DeepCopy()
+
+	for k, v := range r.auditAnnotations(ctx, w) {
+		if err := unstructured.SetNestedField(after.Object, v, "spec", "template", "metadata", "annotations", k); err != nil {
+			return "", err
+		}
+	}
+	if w.paused {
+		if err := unstructured.SetNestedField(after.Object, false, "spec", "paused"); err != nil {
+			return "", err
+		}
+	}
+
+	a, err := yaml.Marshal(before.Object)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(after.Object)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: fmt.Sprintf("%s (live)", w),
+		ToFile:   fmt.Sprintf("%s (restarted)", w),
+		Context:  3,
+	})
+}
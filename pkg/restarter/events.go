@@ -0,0 +1,73 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const eventSourceComponent = "database-restarter"
+
+// Initiator returns who restarts workloads through this Restarter: the API
+// user, or the local user when the API server cannot say.
+func (r *Restarter) Initiator(ctx context.Context) string {
+	return r.initiator(ctx)
+}
+
+func (r *Restarter) initiator(ctx context.Context) string {
+	r.initiatorOnce.Do(func() {
+		review, err := r.clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+		if err == nil && review.Status.UserInfo.Username != "" {
+			r.initiatorName = review.Status.UserInfo.Username
+			return
+		}
+		r.log.Debug("Could not determine the API user, falling back to the local user", "error", err)
+		if user := os.Getenv("USER"); user != "" {
+			r.initiatorName = user
+			return
+		}
+		r.initiatorName = "unknown"
+	})
+	return r.initiatorName
+}
+
+func (r *Restarter) recordRestartEvent(ctx context.Context, w *Workload) {
+	now := metav1.Now()
+	host, _ := os.Hostname()
+	message := fmt.Sprintf("%s triggered by %s (%s) in run %s; matched pods: %s", w.Action, r.initiator(ctx), w.Reason, r.opts.RunID, strings.Join(w.Pods, ", "))
+	if r.opts.EventTemplate != nil {
+		message = r.render(r.opts.EventTemplate, r.messageData(ctx, w), message)
+	}
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: w.Name + ".",
+			Namespace:    w.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: w.apiVersion,
+			Kind:       w.Kind,
+			Namespace:  w.Namespace,
+			Name:       w.Name,
+			UID:        w.uid,
+		},
+		Type:                corev1.EventTypeNormal,
+		Reason:              "RestartTriggered",
+		Message:             message,
+		Source:              corev1.EventSource{Component: eventSourceComponent, Host: host},
+		ReportingController: eventSourceComponent,
+		ReportingInstance:   host,
+		Action:              w.Action,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+
+	if _, err := r.clientset.CoreV1().Events(w.Namespace).Create(ctx, event, metav1.CreateOptions{FieldManager: FieldManager}); err != nil {
+		r.log.Warn("Could not record restart event", "workload", w.String(), "error", err)
+	}
+}
@@ -0,0 +1,114 @@
+package restarter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels and annotations Argo CD and Flux put on the objects they apply.
+const (
+	argoCDTrackingAnnotation = "argocd.argoproj.io/tracking-id"
+	argoCDInstanceLabel      = "argocd.argoproj.io/instance"
+	fluxKustomizationLabel   = "kustomize.toolkit.fluxcd.io/name"
+	fluxHelmReleaseLabel     = "helm.toolkit.fluxcd.io/name"
+)
+
+// ArgoCD is an Argo CD API server that restarts the workloads its
+// Applications manage through their restart resource action, so the restart
+// does not show as drift from the Application's source.
+type ArgoCD struct {
+	// Server is the base URL of the API server, e.g. https://argocd.example.com.
+	Server string
+	Token  string
+	Client *http.Client
+}
+
+// gitOpsOwner is the Argo CD Application or Flux object that applies a
+// workload.
+type gitOpsOwner struct {
+	tool      string
+	namespace string
+	name      string
+}
+
+func (o gitOpsOwner) String() string {
+	if o.namespace == "" {
+		return o.tool + " " + o.name
+	}
+	return o.tool + " " + o.namespace + "/" + o.name
+}
+
+// gitOpsManager finds the GitOps tool, if any, that applies obj.
+func gitOpsManager(obj metav1.Object) (gitOpsOwner, bool) {
+	labels, annotations := obj.GetLabels(), obj.GetAnnotations()
+	// The tracking ID is APP:GROUP/KIND:NAMESPACE/NAME, and APP is
+	// NAMESPACE_NAME for Applications outside Argo CD's own namespace.
+	if tracking, ok := annotations[argoCDTrackingAnnotation]; ok {
+		app, _, _ := strings.Cut(tracking, ":")
+		if namespace, name, ok := strings.Cut(app, "_"); ok {
+			return gitOpsOwner{tool: "Argo CD Application", namespace: namespace, name: name}, true
+		}
+		return gitOpsOwner{tool: "Argo CD Application", name: app}, true
+	}
+	if app, ok := labels[argoCDInstanceLabel]; ok {
+		return gitOpsOwner{tool: "Argo CD Application", name: app}, true
+	}
+	if name, ok := labels[fluxKustomizationLabel]; ok {
+		return gitOpsOwner{tool: "Flux Kustomization", namespace: labels["kustomize.toolkit.fluxcd.io/namespace"], name: name}, true
+	}
+	if name, ok := labels[fluxHelmReleaseLabel]; ok {
+		return gitOpsOwner{tool: "Flux HelmRelease", namespace: labels["helm.toolkit.fluxcd.io/namespace"], name: name}, true
+	}
+	return gitOpsOwner{}, false
+}
+
+func (o gitOpsOwner) argoCD() bool {
+	return o.tool == "Argo CD Application"
+}
+
+// restart runs the Application's restart action on w, which sets the same
+// restartedAt annotation kubectl rollout restart does.
+func (a *ArgoCD) restart(ctx context.Context, app gitOpsOwner, w *Workload) error {
+	query := url.Values{
+		"namespace":    {w.Namespace},
+		"resourceName": {w.Name},
+		"group":        {"apps"},
+		"version":      {"v1"},
+		"kind":         {w.Kind},
+	}
+	if app.namespace != "" {
+		query.Set("appNamespace", app.namespace)
+	}
+	endpoint := strings.TrimSuffix(a.Server, "/") + "/api/v1/applications/" + url.PathEscape(app.name) + "/resource/actions?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader([]byte(`"restart"`)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("running the restart action of %s: %w", app, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("running the restart action of %s: %s: %s", app, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
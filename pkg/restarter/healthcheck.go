@@ -0,0 +1,233 @@
+package restarter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+const healthCheckAttemptTimeout = 5 * time.Second
+
+// ErrHealthCheckFailed is wrapped by Restart when a restarted workload's pods
+// do not pass the health check or post-hook; RestartAll stops starting new
+// restarts once it sees it.
+var ErrHealthCheckFailed = errors.New("health check failed")
+
+// HealthCheck verifies that a pod of a restarted workload is serving.
+type HealthCheck interface {
+	Check(ctx context.Context, pod *corev1.Pod) error
+}
+
+// ParseHealthCheck parses an http:// or https:// URL template such as
+// http://{{.IP}}:8080/healthz, tcp:PORT, or exec:COMMAND, a whitespace
+// separated command run in the pod's first container. config is only needed
+// for exec checks.
+func ParseHealthCheck(spec string, config *rest.Config) (HealthCheck, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		tmpl, err := template.New("health-check").Option("missingkey=error").Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health check URL template: %w", err)
+		}
+		return &httpCheck{url: tmpl}, nil
+	case strings.HasPrefix(spec, "tcp:"):
+		port := strings.TrimPrefix(spec, "tcp:")
+		if _, err := net.LookupPort("tcp", port); err != nil {
+			return nil, fmt.Errorf("invalid health check port %q: %w", port, err)
+		}
+		return &tcpCheck{port: port}, nil
+	case strings.HasPrefix(spec, "exec:"):
+		command := strings.Fields(strings.TrimPrefix(spec, "exec:"))
+		if len(command) == 0 {
+			return nil, fmt.Errorf("invalid health check command %q", spec)
+		}
+		hook, err := NewExecHook(config, command, 0)
+		if err != nil {
+			return nil, err
+		}
+		return execCheck{hook}, nil
+	default:
+		return nil, fmt.Errorf("invalid health check %q: must start with http://, https://, tcp: or exec:", spec)
+	}
+}
+
+type execCheck struct {
+	hook PodHook
+}
+
+func (c execCheck) Check(ctx context.Context, pod *corev1.Pod) error {
+	return c.hook.Run(ctx, pod)
+}
+
+type healthCheckTarget struct {
+	Name      string
+	Namespace string
+	IP        string
+}
+
+type httpCheck struct {
+	url *template.Template
+}
+
+func (c *httpCheck) Check(ctx context.Context, pod *corev1.Pod) error {
+	var url bytes.Buffer
+	if err := c.url.Execute(&url, healthCheckTarget{Name: pod.Name, Namespace: pod.Namespace, IP: pod.Status.PodIP}); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s returned %s", url.String(), resp.Status)
+	}
+	return nil
+}
+
+type tcpCheck struct {
+	port string
+}
+
+func (c *tcpCheck) Check(ctx context.Context, pod *corev1.Pod) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(pod.Status.PodIP, c.port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (r *Restarter) checkHealth(ctx context.Context, w *Workload) error {
+	return r.verifyPods(ctx, w, "health check", r.opts.HealthCheck.Check, r.opts.Timeout, time.Time{})
+}
+
+func (r *Restarter) runPostHook(ctx context.Context, w *Workload) error {
+	timeout := r.opts.PostHookTimeout
+	if timeout == 0 {
+		timeout = r.opts.Timeout
+	}
+	run := func(ctx context.Context, pod *corev1.Pod) error {
+		return r.runHook(ctx, w, "post-hook", r.opts.PostHook, pod)
+	}
+	return r.verifyPods(ctx, w, "post-hook", run, timeout, time.Time{})
+}
+
+// verifyPods retries check against every ready pod of w, or only those
+// created since a non-zero since, until it passes on all of them or timeout
+// elapses.
+func (r *Restarter) verifyPods(ctx context.Context, w *Workload, name string, check func(context.Context, *corev1.Pod) error, timeout time.Duration, since time.Time) error {
+	selector, err := r.workloadSelector(ctx, w)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	err = wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		pods, err := r.clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+
+		checked := 0
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp != nil || !podReady(pod) || pod.CreationTimestamp.Time.Before(since.Truncate(time.Second)) {
+				continue
+			}
+			attemptCtx, cancel := context.WithTimeout(ctx, healthCheckAttemptTimeout)
+			err := check(attemptCtx, pod)
+			cancel()
+			if err != nil {
+				lastErr = fmt.Errorf("pod %s: %w", pod.Name, err)
+				r.log.Debug("Pod did not pass yet", "check", name, "workload", w.String(), "pod", pod.Name, "error", err)
+				return false, nil
+			}
+			checked++
+		}
+		if checked == 0 {
+			lastErr = fmt.Errorf("no ready pods")
+			return false, nil
+		}
+		return true, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("%w: %s for %s did not pass after %s: %v", ErrHealthCheckFailed, name, w, timeout, lastErr)
+	}
+	return err
+}
+
+func (r *Restarter) workloadSelector(ctx context.Context, w *Workload) (string, error) {
+	if cluster, ok := operatorClusters[w.Kind]; ok {
+		return cluster.podSelector(w.Name), nil
+	}
+
+	var selector *metav1.LabelSelector
+	switch w.Kind {
+	case "Deployment":
+		deployment, err := r.clientset.AppsV1().Deployments(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = deployment.Spec.Selector
+	case "StatefulSet":
+		statefulSet, err := r.clientset.AppsV1().StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = statefulSet.Spec.Selector
+	case "DaemonSet":
+		daemonSet, err := r.clientset.AppsV1().DaemonSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = daemonSet.Spec.Selector
+	case "Rollout":
+		rollout, err := r.dynamic.Resource(argoRolloutsResource).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		raw, _, _ := unstructured.NestedMap(rollout.Object, "spec", "selector")
+		selector = &metav1.LabelSelector{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, selector); err != nil {
+			return "", err
+		}
+	case "DeploymentConfig":
+		deploymentConfig, err := r.dynamic.Resource(deploymentConfigsResource).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		matchLabels, _, _ := unstructured.NestedStringMap(deploymentConfig.Object, "spec", "selector")
+		selector = &metav1.LabelSelector{MatchLabels: matchLabels}
+	default:
+		return "", fmt.Errorf("cannot health check unsupported kind %s", w.Kind)
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return labelSelector.String(), nil
+}
@@ -0,0 +1,38 @@
+package restarter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Helm charts label their pods with the release they belong to, and Helm
+// annotates every object it installs with the release's name.
+const (
+	helmInstanceLabel         = "app.kubernetes.io/instance"
+	helmReleaseNameAnnotation = "meta.helm.sh/release-name"
+)
+
+// labelSelector is Selector narrowed to the pods of HelmReleases.
+func (r *Restarter) labelSelector() string {
+	if len(r.opts.HelmReleases) == 0 {
+		return r.opts.Selector
+	}
+	releases := fmt.Sprintf("%s in (%s)", helmInstanceLabel, strings.Join(r.opts.HelmReleases, ","))
+	if r.opts.Selector == "" {
+		return releases
+	}
+	return r.opts.Selector + "," + releases
+}
+
+// otherHelmRelease returns the release that installed obj when it is not one
+// of HelmReleases: the instance label is not Helm's alone, Argo CD sets it too.
+func (r *Restarter) otherHelmRelease(obj metav1.Object) string {
+	release, ok := obj.GetAnnotations()[helmReleaseNameAnnotation]
+	if !ok || slices.Contains(r.opts.HelmReleases, release) {
+		return ""
+	}
+	return release
+}
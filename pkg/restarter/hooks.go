@@ -0,0 +1,212 @@
+package restarter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// PodHook runs an action against a single pod, such as a command inside it.
+type PodHook interface {
+	Run(ctx context.Context, pod *corev1.Pod) error
+}
+
+// maxHookOutput is how much of the end of a hook's stdout and stderr is
+// kept for the report.
+const maxHookOutput = 4096
+
+// HookOutput is what a command run by an exec hook wrote and how it exited.
+type HookOutput struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExecError is returned by exec hooks whose command could not be run, timed
+// out or exited with a non-zero code, with whatever it wrote.
+type ExecError struct {
+	Command []string
+	Output  HookOutput
+	Err     error
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("command %q", strings.Join(e.Command, " "))
+	if e.Output.ExitCode > 0 {
+		msg += fmt.Sprintf(" exited with code %d", e.Output.ExitCode)
+	} else {
+		msg += ": " + e.Err.Error()
+	}
+	if output := strings.TrimSpace(e.Output.Stderr); output != "" {
+		return msg + ": " + output
+	}
+	if output := strings.TrimSpace(e.Output.Stdout); output != "" {
+		return msg + ": " + output
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// outputHook is implemented by hooks whose output goes into the report.
+type outputHook interface {
+	RunWithOutput(ctx context.Context, pod *corev1.Pod) (HookOutput, error)
+}
+
+type execHook struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+	command   []string
+	timeout   time.Duration
+}
+
+// NewExecHook returns a PodHook that runs command in the pod's first
+// container through the exec subresource, over WebSocket or, when the API
+// server or a proxy cannot upgrade to it, SPDY. A non-zero timeout bounds
+// each run. Failures are ExecErrors.
+func NewExecHook(config *rest.Config, command []string, timeout time.Duration) (PodHook, error) {
+	if config == nil {
+		return nil, fmt.Errorf("exec hooks need a rest config")
+	}
+	if len(command) == 0 {
+		return nil, fmt.Errorf("exec hooks need a command")
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &execHook{config: config, clientset: clientset, command: command, timeout: timeout}, nil
+}
+
+func (h *execHook) Run(ctx context.Context, pod *corev1.Pod) error {
+	_, err := h.RunWithOutput(ctx, pod)
+	return err
+}
+
+func (h *execHook) RunWithOutput(ctx context.Context, pod *corev1.Pod) (HookOutput, error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	req := h.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Command:   h.command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := h.executor(req.URL())
+	if err != nil {
+		return HookOutput{}, &ExecError{Command: h.command, Err: err}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	output := HookOutput{Stdout: tail(stdout.String(), maxHookOutput), Stderr: tail(stderr.String(), maxHookOutput)}
+	if err != nil {
+		var exit utilexec.ExitError
+		if errors.As(err, &exit) && exit.Exited() {
+			output.ExitCode = exit.ExitStatus()
+		} else if ctx.Err() != nil && h.timeout > 0 {
+			err = fmt.Errorf("timed out after %s: %w", h.timeout, err)
+		}
+		return output, &ExecError{Command: h.command, Output: output, Err: err}
+	}
+	return output, nil
+}
+
+// executor streams over WebSocket, falling back to SPDY when the upgrade
+// fails, as kubectl exec does.
+func (h *execHook) executor(url *url.URL) (remotecommand.Executor, error) {
+	spdy, err := remotecommand.NewSPDYExecutor(h.config, http.MethodPost, url)
+	if err != nil {
+		return nil, err
+	}
+	websocket, err := remotecommand.NewWebSocketExecutor(h.config, http.MethodGet, url.String())
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocket, spdy, httpstream.IsUpgradeFailure)
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n:]
+}
+
+// runHook runs hook in pod and records the outcome on w, replacing the
+// record of an earlier attempt of the same hook in the same pod.
+func (r *Restarter) runHook(ctx context.Context, w *Workload, name string, hook PodHook, pod *corev1.Pod) error {
+	start := time.Now()
+	var output HookOutput
+	var err error
+	if h, ok := hook.(outputHook); ok {
+		output, err = h.RunWithOutput(ctx, pod)
+	} else {
+		err = hook.Run(ctx, pod)
+	}
+
+	result := HookResult{Hook: name, Pod: pod.Name, ExitCode: output.ExitCode, Stdout: output.Stdout, Stderr: output.Stderr, Duration: time.Since(start).Round(time.Millisecond).String()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	for i := range w.Hooks {
+		if w.Hooks[i].Hook == name && w.Hooks[i].Pod == pod.Name {
+			w.Hooks[i] = result
+			return err
+		}
+	}
+	w.Hooks = append(w.Hooks, result)
+	return err
+}
+
+func (r *Restarter) runPreHook(ctx context.Context, w *Workload) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	for _, name := range w.Pods {
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			r.log.Info("Pod is gone, skipping pre-hook", "pod", w.Namespace+"/"+name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if pod.Status.Phase != corev1.PodRunning {
+			r.log.Info("Pod is not running, skipping pre-hook", "pod", w.Namespace+"/"+name, "phase", pod.Status.Phase)
+			continue
+		}
+
+		r.log.Info("Running pre-hook", "pod", w.Namespace+"/"+name)
+		if err := r.runHook(ctx, w, "pre-hook", r.opts.PreHook, pod); err != nil {
+			return fmt.Errorf("pre-hook failed in pod %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+)
+
+// imagePullFailures are the container waiting reasons that mean an image
+// could not be pulled.
+var imagePullFailures = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// checkImages pulls every image of w's pod template in a short-lived pod on
+// the node of one of its current pods, so a restart is not started when the
+// replacement pods could not pull their images. The pod's containers do not
+// need to run: any container state past pulling counts as pulled.
+func (r *Restarter) checkImages(ctx context.Context, w *Workload) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	current, err := r.currentPod(ctx, w)
+	if err != nil {
+		return err
+	}
+	spec, err := r.podTemplateSpec(ctx, w)
+	if err != nil {
+		return err
+	}
+	if spec == nil {
+		spec = &current.Spec
+	}
+
+	pod := prePullPod(w, spec, current, r.opts.RunID)
+	created, err := r.clientset.CoreV1().Pods(w.Namespace).Create(ctx, pod, metav1.CreateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("creating image check pod: %w", err)
+	}
+	defer func() {
+		err := r.clientset.CoreV1().Pods(w.Namespace).Delete(context.WithoutCancel(ctx), created.Name, metav1.DeleteOptions{GracePeriodSeconds: ptr.To[int64](0)})
+		if err != nil {
+			r.log.Warn("Could not delete image check pod", "pod", w.Namespace+"/"+created.Name, "error", err)
+		}
+	}()
+	r.log.Info("Checking images", "workload", w.String(), "pod", w.Namespace+"/"+created.Name, "node", created.Spec.NodeName)
+
+	err = wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return imagesPulled(pod)
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for images to be pulled", r.opts.Timeout)
+	}
+	return err
+}
+
+// currentPod returns the first of w's matched pods that still exists.
+func (r *Restarter) currentPod(ctx context.Context, w *Workload) (*corev1.Pod, error) {
+	for _, name := range w.Pods {
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return pod, nil
+		}
+	}
+	return nil, fmt.Errorf("none of the pods of %s exist any more", w)
+}
+
+// podTemplateSpec returns the pod spec that w's replacement pods are created
+// from, or nil when w is managed through a kind without a pod template.
+func (r *Restarter) podTemplateSpec(ctx context.Context, w *Workload) (*corev1.PodSpec, error) {
+	if _, ok := r.customOwner(w.Kind); ok {
+		return nil, nil
+	}
+	if _, ok := operatorClusters[w.Kind]; ok {
+		return nil, nil
+	}
+
+	obj, err := r.getWorkloadMeta(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return &obj.Spec.Template.Spec, nil
+	case *appsv1.StatefulSet:
+		return &obj.Spec.Template.Spec, nil
+	case *appsv1.DaemonSet:
+		return &obj.Spec.Template.Spec, nil
+	case *batchv1.Job:
+		return &obj.Spec.Template.Spec, nil
+	case *batchv1.CronJob:
+		return &obj.Spec.JobTemplate.Spec.Template.Spec, nil
+	case *unstructured.Unstructured:
+		template, found, err := unstructured.NestedMap(obj.Object, "spec", "template", "spec")
+		if err != nil || !found {
+			// Argo Rollouts referencing a Deployment through workloadRef.
+			return nil, err
+		}
+		spec := &corev1.PodSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(template, spec); err != nil {
+			return nil, fmt.Errorf("reading pod template of %s: %w", w, err)
+		}
+		return spec, nil
+	}
+	return nil, nil
+}
+
+func prePullPod(w *Workload, spec *corev1.PodSpec, current *corev1.Pod, runID string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: w.Name + "-image-check-",
+			Labels:       map[string]string{runIDAnnotation: runID},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:                      current.Spec.NodeName,
+			Tolerations:                   current.Spec.Tolerations,
+			ServiceAccountName:            spec.ServiceAccountName,
+			AutomountServiceAccountToken:  ptr.To(false),
+			ImagePullSecrets:              spec.ImagePullSecrets,
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   ptr.To(true),
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+		},
+	}
+
+	seen := map[string]bool{}
+	for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		if seen[c.Image] {
+			continue
+		}
+		seen[c.Image] = true
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+			Name:            fmt.Sprintf("image-%d", len(pod.Spec.Containers)),
+			Image:           c.Image,
+			ImagePullPolicy: c.ImagePullPolicy,
+			Command:         []string{"true"},
+			SecurityContext: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: ptr.To(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			},
+		})
+	}
+	return pod
+}
+
+// imagesPulled reports whether every container of pod is past pulling its
+// image, failing as soon as one of them could not be pulled.
+func imagesPulled(pod *corev1.Pod) (bool, error) {
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false, nil
+	}
+	var failures []string
+	pulled := true
+	for _, status := range pod.Status.ContainerStatuses {
+		waiting := status.State.Waiting
+		switch {
+		case waiting == nil:
+		case imagePullFailures[waiting.Reason]:
+			failures = append(failures, fmt.Sprintf("%s: %s: %s", status.Image, waiting.Reason, waiting.Message))
+		case waiting.Reason == "" || waiting.Reason == "ContainerCreating":
+			pulled = false
+		}
+	}
+	if len(failures) > 0 {
+		return false, fmt.Errorf("images cannot be pulled: %s", strings.Join(failures, "; "))
+	}
+	return pulled, nil
+}
@@ -0,0 +1,148 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var generatedJobLabels = []string{
+	"controller-uid",
+	"job-name",
+	batchv1.ControllerUidLabel,
+	batchv1.JobNameLabel,
+}
+
+func (r *Restarter) recreateJob(ctx context.Context, namespace, name string, audit map[string]string) error {
+	jobsClient := r.clientset.BatchV1().Jobs(namespace)
+	job, err := jobsClient.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationForeground
+	err = jobsClient.Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     metav1.NewUIDPreconditions(string(job.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := r.waitForJobDeleted(ctx, namespace, name, r.opts.Timeout); err != nil {
+		return err
+	}
+
+	fresh := cleanJobForRecreate(job)
+	setTemplateAnnotations(&fresh.Spec.Template.ObjectMeta, audit)
+	_, err = jobsClient.Create(ctx, fresh, metav1.CreateOptions{FieldManager: FieldManager})
+	return err
+}
+
+func cleanJobForRecreate(job *batchv1.Job) *batchv1.Job {
+	fresh := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            job.Name,
+			Namespace:       job.Namespace,
+			Labels:          job.Labels,
+			Annotations:     job.Annotations,
+			OwnerReferences: job.OwnerReferences,
+		},
+		Spec: *job.Spec.DeepCopy(),
+	}
+	for _, label := range generatedJobLabels {
+		delete(fresh.Labels, label)
+		delete(fresh.Spec.Template.Labels, label)
+	}
+	if fresh.Spec.ManualSelector == nil || !*fresh.Spec.ManualSelector {
+		fresh.Spec.Selector = nil
+	}
+	return fresh
+}
+
+func setTemplateAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		meta.Annotations[k] = v
+	}
+}
+
+func (r *Restarter) waitForJobDeleted(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		_, err := r.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for job %s/%s to be deleted", timeout, namespace, name)
+	}
+	return err
+}
+
+func (r *Restarter) restartCronJob(ctx context.Context, namespace, name string, audit map[string]string) error {
+	cronJob, err := r.clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	jobs, err := r.clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if owner := metav1.GetControllerOf(job); owner == nil || owner.UID != cronJob.UID || job.Status.Active == 0 {
+			continue
+		}
+		r.log.Info("Deleting active job", "namespace", namespace, "job", job.Name)
+		err := r.clientset.BatchV1().Jobs(namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-restart-%d", name, time.Now().Unix()),
+			Namespace:   namespace,
+			Labels:      cronJob.Spec.JobTemplate.Labels,
+			Annotations: map[string]string{"cronjob.kubernetes.io/instantiate": "manual"},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob")),
+			},
+		},
+		Spec: cronJob.Spec.JobTemplate.Spec,
+	}
+	for k, v := range cronJob.Spec.JobTemplate.Annotations {
+		job.Annotations[k] = v
+	}
+	job.Spec.Template = *job.Spec.Template.DeepCopy()
+	setTemplateAnnotations(&job.Spec.Template.ObjectMeta, audit)
+	r.log.Info("Creating job from cronjob", "namespace", namespace, "job", job.Name, "cronjob", name)
+	_, err = r.clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{FieldManager: FieldManager})
+	return err
+}
+
+func jobStatus(job *batchv1.Job) *RolloutStatus {
+	s := &RolloutStatus{Desired: 1, Updated: job.Status.Active + job.Status.Succeeded}
+	if job.Spec.Completions != nil {
+		s.Desired = *job.Spec.Completions
+	}
+	if job.Status.Ready != nil {
+		s.Ready = *job.Status.Ready
+	}
+	s.Complete = job.Status.Succeeded >= s.Desired
+	return s
+}
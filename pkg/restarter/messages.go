@@ -0,0 +1,52 @@
+package restarter
+
+import (
+	"context"
+	"strings"
+	"text/template"
+)
+
+// MessageData is what Options.ReasonTemplate and Options.EventTemplate are
+// executed with.
+type MessageData struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Pods      []string
+	// Labels are the labels of the workload's first matching pod.
+	Labels map[string]string
+	Action string
+	// Reason is Options.Reason, or why the workload's pods matched.
+	Reason    string
+	RunID     string
+	Initiator string
+}
+
+func (r *Restarter) messageData(ctx context.Context, w *Workload) MessageData {
+	reason := r.opts.Reason
+	if reason == "" {
+		reason = w.Reason
+	}
+	return MessageData{
+		Kind:      w.Kind,
+		Namespace: w.Namespace,
+		Name:      w.Name,
+		Pods:      w.Pods,
+		Labels:    w.podLabels,
+		Action:    w.Action,
+		Reason:    reason,
+		RunID:     r.opts.RunID,
+		Initiator: r.initiator(ctx),
+	}
+}
+
+// render executes tmpl, falling back to fallback when it fails so a broken
+// template never stops a restart.
+func (r *Restarter) render(tmpl *template.Template, data MessageData, fallback string) string {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		r.log.Warn("Could not render template, using the default message", "template", tmpl.Name(), "error", err)
+		return fallback
+	}
+	return b.String()
+}
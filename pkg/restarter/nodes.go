@@ -0,0 +1,63 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// selectNodes resolves Nodes and NodeSelector to the set of node names pods
+// must run on. It leaves r.nodes nil when neither is set.
+func (r *Restarter) selectNodes(ctx context.Context) error {
+	if len(r.opts.Nodes) == 0 && r.opts.NodeSelector == "" {
+		return nil
+	}
+
+	nodes := map[string]bool{}
+	for _, name := range r.opts.Nodes {
+		nodes[name] = true
+	}
+	if r.opts.NodeSelector != "" {
+		list, err := r.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: r.opts.NodeSelector})
+		if err != nil {
+			return fmt.Errorf("listing nodes: %w", err)
+		}
+		if len(list.Items) == 0 {
+			r.log.Warn("No nodes match the node selector", "selector", r.opts.NodeSelector)
+		}
+		for _, node := range list.Items {
+			nodes[node.Name] = true
+		}
+	}
+	r.nodes = nodes
+	return nil
+}
+
+// Cordon marks node unschedulable so pods moved off it are not scheduled
+// back, and reports whether it already was.
+func (r *Restarter) Cordon(ctx context.Context, node string) (bool, error) {
+	current, err := r.clientset.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if current.Spec.Unschedulable {
+		r.log.Info("Node is already cordoned", "node", node)
+		return true, nil
+	}
+	r.log.Info("Cordoning node", "node", node)
+	return false, r.setUnschedulable(ctx, node, true)
+}
+
+// Uncordon marks node schedulable again.
+func (r *Restarter) Uncordon(ctx context.Context, node string) error {
+	r.log.Info("Uncordoning node", "node", node)
+	return r.setUnschedulable(ctx, node, false)
+}
+
+func (r *Restarter) setUnschedulable(ctx context.Context, node string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := r.clientset.CoreV1().Nodes().Patch(ctx, node, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager})
+	return err
+}
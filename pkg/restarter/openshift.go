@@ -0,0 +1,88 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var deploymentConfigsResource = schema.GroupVersionResource{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs"}
+
+// restartDeploymentConfig triggers a new rollout the way oc rollout latest
+// does. The audit annotations go on the DeploymentConfig itself, since a pod
+// template change would trigger a second rollout through its ConfigChange
+// trigger.
+func (r *Restarter) restartDeploymentConfig(ctx context.Context, namespace, name string, audit map[string]string) error {
+	client := r.dynamic.Resource(deploymentConfigsResource).Namespace(namespace)
+
+	annotations := map[string]any{}
+	for k, v := range audit {
+		annotations[k] = v
+	}
+	deploymentConfig := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": deploymentConfigsResource.GroupVersion().String(),
+		"kind":       "DeploymentConfig",
+		"metadata": map[string]any{
+			"name":        name,
+			"namespace":   namespace,
+			"annotations": annotations,
+		},
+	}}
+	if _, err := client.Apply(ctx, name, deploymentConfig, applyOptions); err != nil {
+		return err
+	}
+
+	request := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": deploymentConfigsResource.GroupVersion().String(),
+		"kind":       "DeploymentRequest",
+		"name":       name,
+		"latest":     true,
+		"force":      true,
+	}}
+	_, err := client.Create(ctx, request, metav1.CreateOptions{FieldManager: FieldManager}, "instantiate")
+	return err
+}
+
+func deploymentConfigStatus(deploymentConfig *unstructured.Unstructured) (*RolloutStatus, error) {
+	s := &RolloutStatus{Desired: 1}
+	if replicas, found, _ := unstructured.NestedInt64(deploymentConfig.Object, "spec", "replicas"); found {
+		s.Desired = int32(replicas)
+	}
+	updated, _, _ := unstructured.NestedInt64(deploymentConfig.Object, "status", "updatedReplicas")
+	ready, _, _ := unstructured.NestedInt64(deploymentConfig.Object, "status", "readyReplicas")
+	available, _, _ := unstructured.NestedInt64(deploymentConfig.Object, "status", "availableReplicas")
+	observed, _, _ := unstructured.NestedInt64(deploymentConfig.Object, "status", "observedGeneration")
+	latest, _, _ := unstructured.NestedInt64(deploymentConfig.Object, "status", "latestVersion")
+	s.Updated, s.Ready = int32(updated), int32(ready)
+
+	// The Progressing condition names the replication controller it refers
+	// to, which tells a finished new rollout apart from the previous one.
+	latestController := fmt.Sprintf("%q", fmt.Sprintf("%s-%d", deploymentConfig.GetName(), latest))
+	rolledOut := false
+	conditions, _, _ := unstructured.NestedSlice(deploymentConfig.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]any)
+		if condition["type"] != "Progressing" {
+			continue
+		}
+		message, _ := condition["message"].(string)
+		switch condition["reason"] {
+		case "ProgressDeadlineExceeded":
+			return s, fmt.Errorf("deploymentconfig %s/%s exceeded its progress deadline", deploymentConfig.GetNamespace(), deploymentConfig.GetName())
+		case "RolloutCancelled", "DeploymentConfigRolloutCancelled":
+			return s, fmt.Errorf("rollout of deploymentconfig %s/%s was cancelled", deploymentConfig.GetNamespace(), deploymentConfig.GetName())
+		case "NewReplicationControllerAvailable":
+			rolledOut = strings.Contains(message, latestController)
+		}
+	}
+
+	s.Complete = deploymentConfig.GetGeneration() <= observed &&
+		rolledOut &&
+		s.Updated >= s.Desired &&
+		int32(available) >= s.Desired
+	return s, nil
+}
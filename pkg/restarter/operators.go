@@ -0,0 +1,227 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+)
+
+const zalandoRollingUpdateAnnotation = "zalando-postgres-operator-rolling-update-required"
+
+var (
+	zalandoPostgresResource = schema.GroupVersionResource{Group: "acid.zalan.do", Version: "v1", Resource: "postgresqls"}
+	crunchyPostgresResource = schema.GroupVersionResource{Group: "postgres-operator.crunchydata.com", Version: "v1beta1", Resource: "postgresclusters"}
+	perconaXtraDBResource   = schema.GroupVersionResource{Group: "pxc.percona.com", Version: "v1", Resource: "perconaxtradbclusters"}
+	innoDBClusterResource   = schema.GroupVersionResource{Group: "mysql.oracle.com", Version: "v2", Resource: "innodbclusters"}
+)
+
+// operatorCluster is a database cluster kind whose operator must perform
+// restarts itself; patching the StatefulSet underneath it would race the
+// operator's own failover handling.
+type operatorCluster struct {
+	resource schema.GroupVersionResource
+	// podSelector selects the database pods of the named cluster.
+	podSelector func(name string) string
+	restart     func(ctx context.Context, r *Restarter, w *Workload, audit map[string]string) error
+}
+
+var operatorClusters = map[string]operatorCluster{
+	// Zalando postgres-operator.
+	"postgresql": {
+		resource: zalandoPostgresResource,
+		podSelector: func(name string) string {
+			return "application=spilo,cluster-name=" + name
+		},
+		restart: restartZalandoCluster,
+	},
+	// CrunchyData PGO v5.
+	"PostgresCluster": {
+		resource: crunchyPostgresResource,
+		podSelector: func(name string) string {
+			return "postgres-operator.crunchydata.com/cluster=" + name + ",postgres-operator.crunchydata.com/instance"
+		},
+		restart: restartCrunchyCluster,
+	},
+	// Percona Operator for MySQL based on Percona XtraDB Cluster.
+	"PerconaXtraDBCluster": {
+		resource: perconaXtraDBResource,
+		podSelector: func(name string) string {
+			return "app.kubernetes.io/instance=" + name + ",app.kubernetes.io/component=pxc"
+		},
+		restart: restartPerconaXtraDBCluster,
+	},
+	// Oracle MySQL Operator.
+	"InnoDBCluster": {
+		resource:    innoDBClusterResource,
+		podSelector: innoDBClusterSelector,
+		restart:     restartInnoDBCluster,
+	},
+}
+
+// operatorOwner returns the cluster resource managing statefulSet, if any.
+// Zalando clusters only carry owner references when the operator is
+// configured to set them, so they are also recognised by their labels.
+func operatorOwner(statefulSet *appsv1.StatefulSet) *metav1.OwnerReference {
+	if controller := metav1.GetControllerOf(statefulSet); controller != nil {
+		if _, ok := operatorClusters[controller.Kind]; ok {
+			return controller
+		}
+	}
+	if statefulSet.Labels["application"] == "spilo" && statefulSet.Labels["cluster-name"] != "" {
+		return &metav1.OwnerReference{APIVersion: zalandoPostgresResource.GroupVersion().String(), Kind: "postgresql", Name: statefulSet.Labels["cluster-name"]}
+	}
+	return nil
+}
+
+// restartZalandoCluster flags the cluster's StatefulSet the way the operator
+// does itself when a rolling update is needed, then touches the cluster so
+// the operator syncs it and replaces the pods, replicas first and with a
+// switchover before the primary.
+func restartZalandoCluster(ctx context.Context, r *Restarter, w *Workload, audit map[string]string) error {
+	statefulSet := appsv1ac.StatefulSet(w.Name, w.Namespace).WithAnnotations(map[string]string{zalandoRollingUpdateAnnotation: "true"})
+	if _, err := r.clientset.AppsV1().StatefulSets(w.Namespace).Apply(ctx, statefulSet, applyOptions); err != nil {
+		return fmt.Errorf("flagging statefulset for rolling update: %w", err)
+	}
+	return r.applyClusterAnnotations(ctx, zalandoPostgresResource, w, audit, nil)
+}
+
+// restartCrunchyCluster sets the restarted annotation PGO documents for
+// rolling restarts, which it propagates to every instance.
+func restartCrunchyCluster(ctx context.Context, r *Restarter, w *Workload, audit map[string]string) error {
+	return r.applyClusterAnnotations(ctx, crunchyPostgresResource, w, audit, map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{"restarted": time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+}
+
+// restartPerconaXtraDBCluster changes the cluster's pod annotations so the
+// operator rolls its pods. Only the SmartUpdate strategy restarts the writer
+// last, so other strategies are refused.
+func restartPerconaXtraDBCluster(ctx context.Context, r *Restarter, w *Workload, audit map[string]string) error {
+	cluster, err := r.dynamic.Resource(perconaXtraDBResource).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if strategy, _, _ := unstructured.NestedString(cluster.Object, "spec", "updateStrategy"); strategy != "SmartUpdate" {
+		return fmt.Errorf("%s uses updateStrategy %q; only SmartUpdate restarts the primary last", w, strategy)
+	}
+
+	return r.applyClusterAnnotations(ctx, perconaXtraDBResource, w, audit, map[string]any{
+		"pxc": map[string]any{
+			"annotations": map[string]any{restartedAtAnnotation: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+}
+
+func innoDBClusterSelector(name string) string {
+	return "mysql.oracle.com/cluster=" + name + ",component=mysqld"
+}
+
+// restartInnoDBCluster replaces the cluster's pods one at a time, secondaries
+// first and the primary last, waiting for each to rejoin the group before
+// moving on. The operator handles pod replacement and primary failover.
+func restartInnoDBCluster(ctx context.Context, r *Restarter, w *Workload, audit map[string]string) error {
+	if err := r.applyClusterAnnotations(ctx, innoDBClusterResource, w, audit, nil); err != nil {
+		return err
+	}
+
+	pods, err := r.clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: innoDBClusterSelector(w.Name)})
+	if err != nil {
+		return err
+	}
+	ordered := pods.Items
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Labels["mysql.oracle.com/cluster-role"] != "PRIMARY" && ordered[j].Labels["mysql.oracle.com/cluster-role"] == "PRIMARY"
+	})
+
+	for i := range ordered {
+		pod := &ordered[i]
+		r.log.Info("Deleting pod", "pod", pod.Namespace+"/"+pod.Name, "role", pod.Labels["mysql.oracle.com/cluster-role"])
+		err := r.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, r.podDeleteOptions(pod))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err := r.waitForPodReplaced(ctx, pod.Namespace, pod.Name, pod.UID, r.opts.Timeout+r.opts.DrainPeriod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyClusterAnnotations applies the audit annotations, and spec when set, to
+// a cluster resource.
+func (r *Restarter) applyClusterAnnotations(ctx context.Context, resource schema.GroupVersionResource, w *Workload, audit map[string]string, spec map[string]any) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(resource.GroupVersion().String())
+	obj.SetKind(w.Kind)
+	obj.SetName(w.Name)
+	obj.SetNamespace(w.Namespace)
+	obj.SetAnnotations(audit)
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	_, err := r.dynamic.Resource(resource).Namespace(w.Namespace).Apply(ctx, w.Name, obj, applyOptions)
+	return err
+}
+
+// waitForClusterRestart waits until every pod of the cluster has been
+// replaced since the restart started and is ready again.
+func (r *Restarter) waitForClusterRestart(ctx context.Context, w *Workload, since time.Time, timeout time.Duration, observe func(*RolloutStatus)) error {
+	selector := operatorClusters[w.Kind].podSelector(w.Name)
+	since = since.Truncate(time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var desired int32
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		pods, err := r.clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		// A pod being replaced can be missing from a single listing.
+		desired = max(desired, int32(len(pods.Items)))
+		s := &RolloutStatus{Desired: desired}
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp != nil || pod.CreationTimestamp.Time.Before(since) {
+				continue
+			}
+			s.Updated++
+			if podReady(pod) {
+				s.Ready++
+			}
+		}
+		s.Complete = desired > 0 && s.Ready >= desired
+		observe(s)
+		return s.Complete, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for the operator to restart every pod of %s", timeout, w)
+	}
+	return err
+}
+
+func (r *Restarter) operatorClusterStatus(ctx context.Context, kind, namespace, name string) (*RolloutStatus, error) {
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: operatorClusters[kind].podSelector(name)})
+	if err != nil {
+		return nil, err
+	}
+	s := &RolloutStatus{Desired: int32(len(pods.Items)), Updated: int32(len(pods.Items))}
+	for i := range pods.Items {
+		if podReady(&pods.Items[i]) {
+			s.Ready++
+		}
+	}
+	s.Complete = s.Desired > 0 && s.Ready >= s.Desired
+	return s, nil
+}
@@ -0,0 +1,188 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type ownerResolver struct {
+	clientset kubernetes.Interface
+	informers *Cache
+	custom    map[string]bool
+	cache     map[string]*metav1.OwnerReference
+	// mu guards cache, which watch handlers for several namespaces share.
+	mu sync.Mutex
+}
+
+func newOwnerResolver(clientset kubernetes.Interface, informers *Cache, custom map[string]bool) *ownerResolver {
+	return &ownerResolver{clientset: clientset, informers: informers, custom: custom, cache: map[string]*metav1.OwnerReference{}}
+}
+
+func (r *ownerResolver) cached(key string) (*metav1.OwnerReference, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owner, ok := r.cache[key]
+	return owner, ok
+}
+
+func (r *ownerResolver) store(key string, owner *metav1.OwnerReference) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache[key] = owner
+}
+
+func (r *ownerResolver) resolve(ctx context.Context, pod *corev1.Pod) (*metav1.OwnerReference, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil, nil
+	}
+
+	var err error
+	switch owner.Kind {
+	case "ReplicaSet":
+		owner, err = r.resolveReplicaSet(ctx, pod.Namespace, owner)
+	case "Job":
+		owner, err = r.resolveJob(ctx, pod.Namespace, owner)
+	case "ReplicationController":
+		owner, err = r.resolveReplicationController(ctx, pod.Namespace, owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.resolveManagingOwner(ctx, pod.Namespace, owner)
+}
+
+// resolveManagingOwner returns the database operator cluster managing a
+// StatefulSet, or the controller of a StatefulSet, Deployment or DaemonSet
+// when it is one of the configured custom owner kinds.
+func (r *ownerResolver) resolveManagingOwner(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*metav1.OwnerReference, error) {
+	if owner.Kind != "StatefulSet" && len(r.custom) == 0 {
+		return owner, nil
+	}
+	key := owner.Kind + "/" + namespace + "/" + owner.Name
+	if cached, ok := r.cached(key); ok {
+		return cached, nil
+	}
+
+	var obj metav1.Object
+	var err error
+	switch owner.Kind {
+	case "StatefulSet":
+		statefulSet, err := getStatefulSet(ctx, r.clientset, r.informers, namespace, owner.Name)
+		if err != nil {
+			return nil, err
+		}
+		if cluster := operatorOwner(statefulSet); cluster != nil {
+			r.store(key, cluster)
+			return cluster, nil
+		}
+		obj = statefulSet
+	case "Deployment":
+		obj, err = getDeployment(ctx, r.clientset, r.informers, namespace, owner.Name)
+	case "DaemonSet":
+		obj, err = r.clientset.AppsV1().DaemonSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	default:
+		return owner, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := owner
+	if controller := metav1.GetControllerOf(obj); controller != nil && r.custom[controller.Kind] {
+		resolved = controller
+	}
+	r.store(key, resolved)
+	return resolved, nil
+}
+
+func (r *ownerResolver) resolveReplicaSet(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*metav1.OwnerReference, error) {
+	key := "ReplicaSet/" + namespace + "/" + owner.Name
+	if cached, ok := r.cached(key); ok {
+		return cached, nil
+	}
+
+	replicaSet, err := getReplicaSet(ctx, r.clientset, r.informers, namespace, owner.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := owner
+	if rsOwner := metav1.GetControllerOf(replicaSet); rsOwner != nil {
+		resolved = rsOwner
+	}
+	r.store(key, resolved)
+	return resolved, nil
+}
+
+func (r *ownerResolver) resolveJob(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*metav1.OwnerReference, error) {
+	key := "Job/" + namespace + "/" + owner.Name
+	if cached, ok := r.cached(key); ok {
+		return cached, nil
+	}
+
+	job, err := r.clientset.BatchV1().Jobs(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := owner
+	if jobOwner := metav1.GetControllerOf(job); jobOwner != nil && jobOwner.Kind == "CronJob" {
+		resolved = jobOwner
+	}
+	r.store(key, resolved)
+	return resolved, nil
+}
+
+func (r *ownerResolver) resolveReplicationController(ctx context.Context, namespace string, owner *metav1.OwnerReference) (*metav1.OwnerReference, error) {
+	key := "ReplicationController/" + namespace + "/" + owner.Name
+	if cached, ok := r.cached(key); ok {
+		return cached, nil
+	}
+
+	controller, err := r.clientset.CoreV1().ReplicationControllers(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := owner
+	if rcOwner := metav1.GetControllerOf(controller); rcOwner != nil && rcOwner.Kind == "DeploymentConfig" {
+		resolved = rcOwner
+	}
+	r.store(key, resolved)
+	return resolved, nil
+}
+
+func (r *Restarter) getWorkloadMeta(ctx context.Context, w *Workload) (metav1.Object, error) {
+	if _, ok := r.customOwner(w.Kind); ok {
+		return r.getCustomOwner(ctx, w)
+	}
+	if cluster, ok := operatorClusters[w.Kind]; ok {
+		return r.dynamic.Resource(cluster.resource).Namespace(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	}
+
+	kind, namespace, name := w.Kind, w.Namespace, w.Name
+	switch kind {
+	case "Deployment":
+		return getDeployment(ctx, r.clientset, r.opts.Cache, namespace, name)
+	case "StatefulSet":
+		return getStatefulSet(ctx, r.clientset, r.opts.Cache, namespace, name)
+	case "DaemonSet":
+		return r.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Job":
+		return r.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "CronJob":
+		return r.clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Rollout":
+		return r.dynamic.Resource(argoRolloutsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "DeploymentConfig":
+		return r.dynamic.Resource(deploymentConfigsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+}
@@ -0,0 +1,143 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// partitionFromAnnotation records the partition a StatefulSet had before a
+// partitioned restart walked it down, so an interrupted restart can be
+// resumed from where it stopped and the partition restored at the end.
+const partitionFromAnnotation = "restart-tool/partition-from"
+
+func partitionApplies(statefulSet *appsv1.StatefulSet) bool {
+	return statefulSet.Spec.UpdateStrategy.Type == "" || statefulSet.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType
+}
+
+// partitionedRestartStatefulSet restarts a RollingUpdate StatefulSet by
+// raising its partition to its replicas along with the restart annotations,
+// then lowering it one ordinal at a time, from the highest, down to where it
+// was. StatefulSets with another update strategy have their pods deleted
+// one at a time instead. Each pod must be updated, ready and healthy before
+// the next ordinal is released. A StatefulSet left mid-way by an interrupted
+// run is resumed at its current partition rather than restarted from the top.
+func (r *Restarter) partitionedRestartStatefulSet(ctx context.Context, w *Workload, audit map[string]string) error {
+	statefulSet, err := r.clientset.AppsV1().StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !partitionApplies(statefulSet) {
+		r.log.Info("StatefulSet does not use RollingUpdate, restarting it without partitions", "workload", w.String(), "updateStrategy", statefulSet.Spec.UpdateStrategy.Type)
+		return r.onDeleteRestartStatefulSet(ctx, w, audit)
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	partition := int32(0)
+	if rolling := statefulSet.Spec.UpdateStrategy.RollingUpdate; rolling != nil && rolling.Partition != nil {
+		partition = *rolling.Partition
+	}
+
+	original, next := partition, replicas
+	recorded, resuming := statefulSet.Annotations[partitionFromAnnotation]
+	resuming = resuming && statefulSet.Status.UpdateRevision != statefulSet.Status.CurrentRevision
+	if resuming {
+		parsed, err := strconv.ParseInt(recorded, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %q", partitionFromAnnotation, recorded)
+		}
+		original, next = int32(parsed), partition
+		r.log.Info("Resuming partitioned restart", "workload", w.String(), "partition", partition, "originalPartition", original)
+	} else {
+		annotations := map[string]any{partitionFromAnnotation: strconv.Itoa(int(original))}
+		templateAnnotations := map[string]any{}
+		for k, v := range audit {
+			templateAnnotations[k] = v
+		}
+		if err := r.patchStatefulSet(ctx, w, map[string]any{
+			"metadata": map[string]any{"annotations": annotations},
+			"spec": map[string]any{
+				"updateStrategy": map[string]any{"rollingUpdate": map[string]any{"partition": replicas}},
+				"template":       map[string]any{"metadata": map[string]any{"annotations": templateAnnotations}},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	for ordinal := next - 1; ordinal >= original; ordinal-- {
+		r.log.Info("Lowering partition", "workload", w.String(), "partition", ordinal)
+		if err := r.patchStatefulSet(ctx, w, map[string]any{
+			"spec": map[string]any{"updateStrategy": map[string]any{"rollingUpdate": map[string]any{"partition": ordinal}}},
+		}); err != nil {
+			return err
+		}
+		if err := r.waitForPodUpdated(ctx, w, ordinal); err != nil {
+			return err
+		}
+		if err := r.waitForCaughtUp(ctx, w.Namespace, fmt.Sprintf("%s-%d", w.Name, ordinal)); err != nil {
+			return err
+		}
+	}
+
+	return r.patchStatefulSet(ctx, w, map[string]any{
+		"metadata": map[string]any{"annotations": map[string]any{partitionFromAnnotation: nil}},
+	})
+}
+
+func (r *Restarter) patchStatefulSet(ctx context.Context, w *Workload, patch map[string]any) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = r.clientset.AppsV1().StatefulSets(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+	return err
+}
+
+// waitForPodUpdated waits for the pod at ordinal to run the StatefulSet's
+// update revision and be ready, then runs the HealthCheck against it.
+func (r *Restarter) waitForPodUpdated(ctx context.Context, w *Workload, ordinal int32) error {
+	name := fmt.Sprintf("%s-%d", w.Name, ordinal)
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	var lastErr error
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		statefulSet, err := r.clientset.AppsV1().StatefulSets(w.Namespace).Get(ctx, w.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != statefulSet.Status.UpdateRevision || !podReady(pod) {
+			return false, nil
+		}
+		if r.opts.HealthCheck != nil {
+			if lastErr = r.opts.HealthCheck.Check(ctx, pod); lastErr != nil {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if wait.Interrupted(err) {
+		if lastErr != nil {
+			return fmt.Errorf("%w: pod %s/%s: %v", ErrHealthCheckFailed, w.Namespace, name, lastErr)
+		}
+		return fmt.Errorf("timed out after %s waiting for pod %s/%s to be updated and ready", r.opts.Timeout, w.Namespace, name)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func (r *Restarter) checkDisruptionBudgets(ctx context.Context, w *Workload) error {
+	pdbs, err := r.clientset.PolicyV1().PodDisruptionBudgets(w.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range pdbs.Items {
+		pdb := &pdbs.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(w.podLabels)) {
+			continue
+		}
+		if pdb.Status.DisruptionsAllowed < 1 {
+			return fmt.Errorf("PodDisruptionBudget %s allows no disruptions (%s, %d/%d healthy)",
+				pdb.Name, describeBudget(pdb), pdb.Status.CurrentHealthy, pdb.Status.DesiredHealthy)
+		}
+	}
+	return nil
+}
+
+func describeBudget(pdb *policyv1.PodDisruptionBudget) string {
+	if pdb.Spec.MinAvailable != nil {
+		return "minAvailable=" + pdb.Spec.MinAvailable.String()
+	}
+	if pdb.Spec.MaxUnavailable != nil {
+		return "maxUnavailable=" + pdb.Spec.MaxUnavailable.String()
+	}
+	return "no budget"
+}
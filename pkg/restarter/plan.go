@@ -0,0 +1,425 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// NamePattern matches pod names with a glob, or a regex when prefixed with re:.
+type NamePattern struct {
+	raw   string
+	regex *regexp.Regexp
+}
+
+// ParseNamePattern parses a glob such as db-* or a regex such as re:^pg-\d+$.
+func ParseNamePattern(raw string) (NamePattern, error) {
+	if expr, ok := strings.CutPrefix(raw, "re:"); ok {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return NamePattern{}, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		return NamePattern{raw: raw, regex: regex}, nil
+	}
+	if _, err := path.Match(raw, ""); err != nil {
+		return NamePattern{}, fmt.Errorf("invalid glob %q: %w", raw, err)
+	}
+	return NamePattern{raw: raw}, nil
+}
+
+// literal returns the name p matches when it matches only that one.
+func (p NamePattern) literal() (string, bool) {
+	if p.regex != nil || strings.ContainsAny(p.raw, `*?[\`) {
+		return "", false
+	}
+	return p.raw, true
+}
+
+func (p NamePattern) matches(name string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(name)
+	}
+	matched, _ := path.Match(p.raw, name)
+	return matched
+}
+
+// WorkloadPattern matches workloads as [KIND/]NAMESPACE/NAME, where each
+// part may be a glob.
+type WorkloadPattern struct {
+	raw                   string
+	kind, namespace, name string
+}
+
+// ParseWorkloadPattern parses a pattern such as StatefulSet/prod/postgres,
+// databases/* or */*-primary.
+func ParseWorkloadPattern(raw string) (WorkloadPattern, error) {
+	parts := strings.Split(raw, "/")
+	p := WorkloadPattern{raw: raw, kind: "*"}
+	switch len(parts) {
+	case 2:
+		p.namespace, p.name = parts[0], parts[1]
+	case 3:
+		p.kind, p.namespace, p.name = strings.ToLower(parts[0]), parts[1], parts[2]
+	default:
+		return WorkloadPattern{}, fmt.Errorf("invalid workload pattern %q: must be [KIND/]NAMESPACE/NAME", raw)
+	}
+	for _, part := range []string{p.kind, p.namespace, p.name} {
+		if _, err := path.Match(part, ""); err != nil || part == "" {
+			return WorkloadPattern{}, fmt.Errorf("invalid workload pattern %q", raw)
+		}
+	}
+	return p, nil
+}
+
+func (p WorkloadPattern) matches(w *Workload) bool {
+	kind, _ := path.Match(p.kind, strings.ToLower(w.Kind))
+	namespace, _ := path.Match(p.namespace, w.Namespace)
+	name, _ := path.Match(p.name, w.Name)
+	return kind && namespace && name
+}
+
+func (r *Restarter) namespaceExcluded(namespace string) bool {
+	for _, excluded := range r.opts.ExcludeNamespaces {
+		if matched, _ := path.Match(excluded, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusionReason returns why w is excluded, or "" when it is not.
+func (r *Restarter) exclusionReason(w *Workload) string {
+	for _, p := range r.opts.Exclude {
+		if p.matches(w) {
+			return fmt.Sprintf("excluded by %q", p.raw)
+		}
+	}
+	return ""
+}
+
+// MatchPod reports whether pod matches the configured patterns, and why.
+// Pods in excluded namespaces never match.
+func (r *Restarter) MatchPod(pod *corev1.Pod) (string, bool) {
+	if r.namespaceExcluded(pod.Namespace) {
+		return "", false
+	}
+	if r.nodes != nil && !r.nodes[pod.Spec.NodeName] {
+		return "", false
+	}
+
+	var reasons []string
+	if r.opts.Selector != "" {
+		reasons = append(reasons, fmt.Sprintf("matches selector %q", r.opts.Selector))
+	}
+	if r.opts.FieldSelector != "" {
+		reasons = append(reasons, fmt.Sprintf("matches field selector %q", r.opts.FieldSelector))
+	}
+	if len(r.opts.HelmReleases) > 0 {
+		release := pod.Labels[helmInstanceLabel]
+		if !slices.Contains(r.opts.HelmReleases, release) {
+			return "", false
+		}
+		reasons = append(reasons, "in helm release "+release)
+	}
+	if len(r.opts.Patterns) > 0 {
+		matched := false
+		for _, p := range r.opts.Patterns {
+			if p.matches(pod.Name) {
+				reasons = append(reasons, fmt.Sprintf("name matches %q", p.raw))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+	if r.nodes != nil {
+		reasons = append(reasons, "runs on node "+pod.Spec.NodeName)
+	}
+	if len(r.opts.PVCs) > 0 || len(r.opts.StorageClasses) > 0 {
+		reason, ok := r.matchClaims(pod)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(r.opts.ImagePatterns) > 0 {
+		reason, ok := matchImage(pod, r.opts.ImagePatterns)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, reason)
+	}
+	if len(r.opts.Expressions) > 0 {
+		reason, ok := r.matchExpressions(pod)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, reason)
+	}
+	if r.opts.MinRestarts > 0 || r.opts.LastState != "" || r.opts.OlderThan > 0 {
+		statusReasons, ok := r.matchStatus(pod)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, statusReasons...)
+	}
+	if r.usage != nil {
+		usageReasons, ok := r.matchUsage(pod)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, usageReasons...)
+	}
+	return strings.Join(reasons, ", "), true
+}
+
+func (r *Restarter) matchStatus(pod *corev1.Pod) ([]string, bool) {
+	var reasons []string
+	if r.opts.OlderThan > 0 {
+		if pod.Status.StartTime == nil || time.Since(pod.Status.StartTime.Time) < r.opts.OlderThan {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("started %s ago", time.Since(pod.Status.StartTime.Time).Round(time.Minute)))
+	}
+	if r.opts.MinRestarts > 0 {
+		matched := false
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.RestartCount >= r.opts.MinRestarts {
+				reasons = append(reasons, fmt.Sprintf("container %s restarted %d times", status.Name, status.RestartCount))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	if r.opts.LastState != "" {
+		matched := false
+		for _, status := range pod.Status.ContainerStatuses {
+			if terminated := status.LastTerminationState.Terminated; terminated != nil && strings.EqualFold(terminated.Reason, r.opts.LastState) {
+				reasons = append(reasons, fmt.Sprintf("container %s last terminated with %s", status.Name, terminated.Reason))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	return reasons, true
+}
+
+func matchImage(pod *corev1.Pod, patterns []NamePattern) (string, bool) {
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		short := c.Image[strings.LastIndex(c.Image, "/")+1:]
+		for _, p := range patterns {
+			if p.matches(c.Image) || p.matches(short) {
+				return fmt.Sprintf("image %s matches %q", c.Image, p.raw), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Plan resolves the matching pods to the workloads that own them, skipping
+// pods without a restartable controller and workloads that opted out, and
+// orders the workloads after the ones they depend on.
+func (r *Restarter) Plan(ctx context.Context, pods *corev1.PodList) ([]*Workload, []SkippedPod) {
+	ctx, span := tracer.Start(ctx, "resolve owners", trace.WithAttributes(attribute.Int("k8s.pods", len(pods.Items))))
+	defer span.End()
+
+	var plan []*Workload
+	var skipped []SkippedPod
+	resolver := newOwnerResolver(r.clientset, r.opts.Cache, r.customKinds())
+	seen := map[string]*Workload{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		reason, ok := r.MatchPod(pod)
+		if !ok {
+			r.log.Debug("Pod did not match", "pod", pod.Namespace+"/"+pod.Name)
+			continue
+		}
+		r.log.Debug("Pod matched", "pod", pod.Namespace+"/"+pod.Name, "reason", reason)
+
+		podOwner, err := resolver.resolve(ctx, pod)
+		if err != nil {
+			r.log.Warn("Skipping pod, owner lookup failed", "pod", pod.Namespace+"/"+pod.Name, "error", err)
+			skipped = append(skipped, SkippedPod{Namespace: pod.Namespace, Name: pod.Name, Result: PodErrored, Reason: "owner lookup failed: " + err.Error()})
+			continue
+		}
+		if podOwner == nil {
+			r.log.Info("Skipping pod without a controller", "pod", pod.Namespace+"/"+pod.Name)
+			skipped = append(skipped, SkippedPod{Namespace: pod.Namespace, Name: pod.Name, Result: SkippedNoOwner, Reason: "no controller"})
+			continue
+		}
+		if !r.restartableKind(podOwner.Kind) {
+			r.log.Info("Skipping pod with unsupported controller", "pod", pod.Namespace+"/"+pod.Name, "kind", podOwner.Kind)
+			skipped = append(skipped, SkippedPod{Namespace: pod.Namespace, Name: pod.Name, Result: SkippedUnsupportedKind, Reason: "unsupported controller kind " + podOwner.Kind})
+			continue
+		}
+
+		key := podOwner.Kind + "/" + pod.Namespace + "/" + podOwner.Name
+		w, ok := seen[key]
+		if !ok {
+			w = r.newWorkload(podOwner.Kind, pod.Namespace, podOwner.Name, reason)
+			w.apiVersion, w.uid = podOwner.APIVersion, podOwner.UID
+			w.podLabels = pod.Labels
+			seen[key] = w
+			plan = append(plan, w)
+		}
+		w.Pods = append(w.Pods, pod.Name)
+	}
+	return r.checkPlan(ctx, plan, skipped)
+}
+
+// checkPlan drops the workloads of plan that are excluded, opted out or
+// otherwise not to be restarted, adding their pods to skipped, and orders
+// the rest after the ones they depend on.
+func (r *Restarter) checkPlan(ctx context.Context, plan []*Workload, skipped []SkippedPod) ([]*Workload, []SkippedPod) {
+	var allowed []*Workload
+	hashes := map[string]string{}
+	dependencies := map[*Workload]string{}
+	for _, w := range plan {
+		if reason := r.exclusionReason(w); reason != "" {
+			r.log.Info("Skipping excluded workload", "workload", w.String(), "reason", reason)
+			skipped = append(skipped, w.skipPods(SkippedExcluded, reason)...)
+			continue
+		}
+		obj, err := r.getWorkloadMeta(ctx, w)
+		if err != nil {
+			r.log.Warn("Skipping workload, lookup failed", "workload", w.String(), "error", err)
+			skipped = append(skipped, w.skipPods(PodErrored, "workload lookup failed: "+err.Error())...)
+			continue
+		}
+		if release := r.otherHelmRelease(obj); len(r.opts.HelmReleases) > 0 && release != "" {
+			r.log.Info("Skipping workload installed by another helm release", "workload", w.String(), "release", release)
+			skipped = append(skipped, w.skipPods(SkippedExcluded, "installed by helm release "+release)...)
+			continue
+		}
+		if reason := optOutReason(obj.GetAnnotations()); reason != "" {
+			r.log.Info("Skipping opted-out workload", "workload", w.String(), "reason", reason)
+			skipped = append(skipped, w.skipPods(SkippedExcluded, reason)...)
+			continue
+		}
+		if _, ok := templateResources[w.Kind]; ok && w.Action == "restart" && propagated(obj) {
+			if r.opts.Federation == nil {
+				r.log.Warn("Skipping workload propagated by Karmada, a restart of this copy would be reverted", "workload", w.String())
+				skipped = append(skipped, w.skipPods(SkippedPropagated, "propagated by Karmada, restart it through the control plane")...)
+				continue
+			}
+			r.log.Info("Workload is propagated by Karmada, its resource template will be restarted", "workload", w.String())
+			w.propagated = true
+		}
+		if owner, ok := gitOpsManager(obj); ok && w.Action == "restart" {
+			w.ManagedBy = owner.String()
+			if _, ok := templateResources[w.Kind]; ok && owner.argoCD() && r.opts.ArgoCD != nil && !w.propagated {
+				r.log.Info("Workload is managed by Argo CD, it will be restarted through the Application's restart action", "workload", w.String(), "managedBy", w.ManagedBy)
+				w.argoCDApp = &owner
+			} else {
+				r.log.Warn("Workload is managed by GitOps, the restart annotations will show as drift from its source", "workload", w.String(), "managedBy", w.ManagedBy)
+			}
+		}
+		if deployment, ok := obj.(*appsv1.Deployment); ok && deployment.Spec.Paused && w.Action == "restart" {
+			if !r.opts.ResumePaused {
+				r.log.Warn("Skipping paused deployment, its rollout would not start until it is resumed", "workload", w.String())
+				skipped = append(skipped, w.skipPods(SkippedPaused, "deployment is paused")...)
+				continue
+			}
+			r.log.Info("Deployment is paused, it will be resumed for the restart and paused again afterwards", "workload", w.String())
+			w.paused = true
+		}
+		if statefulSet, ok := obj.(*appsv1.StatefulSet); ok && statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType &&
+			(w.Action == "restart" || w.Action == "partitioned-restart") && !w.propagated && w.argoCDApp == nil {
+			r.log.Info("StatefulSet uses the OnDelete update strategy, its pods will be deleted one at a time", "workload", w.String())
+			w.Action = "ordered-restart"
+			w.onDelete = true
+		}
+		if r.opts.Cooldown > 0 {
+			if restarted, ok := lastRestarted(obj); ok && time.Since(restarted) < r.opts.Cooldown {
+				reason := fmt.Sprintf("restarted %s ago, within the %s cooldown", time.Since(restarted).Round(time.Second), r.opts.Cooldown)
+				r.log.Info("Skipping recently restarted workload", "workload", w.String(), "reason", reason)
+				skipped = append(skipped, w.skipPods(SkippedCooldown, reason)...)
+				continue
+			}
+		}
+		if len(r.opts.IfChanged) > 0 {
+			hash, ok := hashes[w.Namespace]
+			if !ok {
+				if hash, err = r.configHash(ctx, w.Namespace); err != nil {
+					r.log.Warn("Skipping workload, config lookup failed", "workload", w.String(), "error", err)
+					skipped = append(skipped, w.skipPods(PodErrored, "config lookup failed: "+err.Error())...)
+					continue
+				}
+				hashes[w.Namespace] = hash
+			}
+			if obj.GetAnnotations()[configHashAnnotation] == hash {
+				r.log.Info("Skipping workload, config unchanged", "workload", w.String())
+				skipped = append(skipped, w.skipPods(SkippedUnchanged, "config unchanged")...)
+				continue
+			}
+			w.configHash = hash
+		}
+		dependencies[w] = obj.GetAnnotations()[dependsOnAnnotation]
+		allowed = append(allowed, w)
+	}
+
+	allowed, cyclic := r.orderPlan(allowed, dependencies)
+	skipped = append(skipped, cyclic...)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("restart.workloads", len(allowed)), attribute.Int("restart.skipped.pods", len(skipped)))
+	return allowed, skipped
+}
+
+// lastRestarted returns when obj was last restarted, by this tool or by
+// kubectl rollout restart, from wherever its kind records it. Scale bounces
+// record it on the workload itself rather than its pod template, so the
+// later of the two counts.
+func lastRestarted(obj metav1.Object) (time.Time, bool) {
+	annotations := obj.GetAnnotations()
+	var template map[string]string
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		template = obj.Spec.Template.Annotations
+	case *appsv1.StatefulSet:
+		template = obj.Spec.Template.Annotations
+	case *appsv1.DaemonSet:
+		template = obj.Spec.Template.Annotations
+	case *batchv1.Job:
+		return obj.CreationTimestamp.Time, true
+	case *unstructured.Unstructured:
+		if restartAt, found, _ := unstructured.NestedString(obj.Object, "spec", "restartAt"); found {
+			annotations = map[string]string{restartedAtAnnotation: restartAt}
+		}
+	}
+	restarted, err := time.Parse(time.RFC3339, annotations[restartedAtAnnotation])
+	ok := err == nil
+	if fromTemplate, err := time.Parse(time.RFC3339, template[restartedAtAnnotation]); err == nil && (!ok || fromTemplate.After(restarted)) {
+		restarted, ok = fromTemplate, true
+	}
+	return restarted, ok
+}
+
+func optOutReason(annotations map[string]string) string {
+	if strings.EqualFold(annotations[enabledAnnotation], "false") {
+		return enabledAnnotation + " is false"
+	}
+	if annotations[policyAnnotation] == "manual-only" {
+		return policyAnnotation + " is manual-only"
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package restarter
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseWorkloadPattern(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    WorkloadPattern
+		wantErr bool
+	}{
+		{raw: "prod/postgres", want: WorkloadPattern{raw: "prod/postgres", kind: "*", namespace: "prod", name: "postgres"}},
+		{raw: "StatefulSet/prod/postgres", want: WorkloadPattern{raw: "StatefulSet/prod/postgres", kind: "statefulset", namespace: "prod", name: "postgres"}},
+		{raw: "*/*-primary", want: WorkloadPattern{raw: "*/*-primary", kind: "*", namespace: "*", name: "*-primary"}},
+		{raw: "postgres", wantErr: true},
+		{raw: "a/b/c/d", wantErr: true},
+		{raw: "prod/", wantErr: true},
+		{raw: "/postgres", wantErr: true},
+		{raw: "prod/[postgres", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWorkloadPattern(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWorkloadPattern(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseWorkloadPattern(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestWorkloadPatternMatches(t *testing.T) {
+	postgres := &Workload{Kind: "StatefulSet", Namespace: "prod", Name: "postgres"}
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"prod/postgres", true},
+		{"statefulset/prod/postgres", true},
+		{"StatefulSet/prod/post*", true},
+		{"Deployment/prod/postgres", false},
+		{"staging/postgres", false},
+		{"*/*-primary", false},
+	}
+	for _, tt := range tests {
+		p, err := ParseWorkloadPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParseWorkloadPattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.matches(postgres); got != tt.want {
+			t.Errorf("%q matches %s = %t, want %t", tt.pattern, postgres, got, tt.want)
+		}
+	}
+}
+
+func TestLastRestarted(t *testing.T) {
+	earlier := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	deployment := func(metadata, template time.Time) *appsv1.Deployment {
+		d := &appsv1.Deployment{}
+		if !metadata.IsZero() {
+			d.Annotations = map[string]string{restartedAtAnnotation: metadata.Format(time.RFC3339)}
+		}
+		if !template.IsZero() {
+			d.Spec.Template.Annotations = map[string]string{restartedAtAnnotation: template.Format(time.RFC3339)}
+		}
+		return d
+	}
+	tests := []struct {
+		name   string
+		obj    metav1.Object
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "never restarted", obj: deployment(time.Time{}, time.Time{})},
+		{name: "rollout restart", obj: deployment(time.Time{}, earlier), want: earlier, wantOK: true},
+		{name: "scale bounce", obj: deployment(earlier, time.Time{}), want: earlier, wantOK: true},
+		{name: "scale bounce after rollout restart", obj: deployment(later, earlier), want: later, wantOK: true},
+		{name: "rollout restart after scale bounce", obj: deployment(earlier, later), want: later, wantOK: true},
+	}
+	for _, tt := range tests {
+		got, ok := lastRestarted(tt.obj)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("%s: lastRestarted = %s, %t, want %s, %t", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
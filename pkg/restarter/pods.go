@@ -0,0 +1,151 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// replaceMatchedPods bounces only the pods of w that matched, one at a time,
+// waiting for each replacement to become ready and for the disruption budgets
+// to allow the next deletion or eviction.
+func (r *Restarter) replaceMatchedPods(ctx context.Context, w *Workload) error {
+	for i, name := range w.Pods {
+		pod, err := r.clientset.CoreV1().Pods(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			r.log.Info("Pod does not exist, skipping", "pod", w.Namespace+"/"+name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if w.Action == "evict" {
+			if err := r.evictPod(ctx, pod, r.opts.Timeout); err != nil {
+				return err
+			}
+		} else {
+			// Restart already checked the budgets before the first pod.
+			if i > 0 && !r.opts.Force {
+				if err := r.waitForDisruptionBudgets(ctx, w, r.opts.Timeout); err != nil {
+					return err
+				}
+			}
+			r.log.Info("Deleting pod", "pod", w.Namespace+"/"+name)
+			err = r.clientset.CoreV1().Pods(w.Namespace).Delete(ctx, name, r.podDeleteOptions(pod))
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+
+		if err := r.waitForPodGone(ctx, w.Namespace, name, pod.UID, r.opts.Timeout+r.opts.DrainPeriod); err != nil {
+			return err
+		}
+		if err := r.waitForReplicasReady(ctx, w, r.opts.Timeout); err != nil {
+			return err
+		}
+		r.log.Info("Replacement pod is ready", "workload", w.String(), "pod", w.Namespace+"/"+name)
+	}
+	return nil
+}
+
+// evictPod asks the API server to evict pod, retrying for as long as a
+// PodDisruptionBudget refuses, the same way kubectl drain does.
+func (r *Restarter) evictPod(ctx context.Context, pod *corev1.Pod, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	deleteOptions := r.podDeleteOptions(pod)
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &deleteOptions,
+	}
+	var lastErr error
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		r.log.Info("Evicting pod", "pod", pod.Namespace+"/"+pod.Name)
+		lastErr = r.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case lastErr == nil, apierrors.IsNotFound(lastErr):
+			return true, nil
+		case apierrors.IsTooManyRequests(lastErr):
+			r.log.Info("Eviction refused by disruption budget, retrying", "pod", pod.Namespace+"/"+pod.Name, "error", lastErr)
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s evicting pod %s/%s: %v", timeout, pod.Namespace, pod.Name, lastErr)
+	}
+	return err
+}
+
+// podDeleteOptions deletes exactly pod, giving it DrainPeriod to shut down
+// instead of its own terminationGracePeriodSeconds when set.
+func (r *Restarter) podDeleteOptions(pod *corev1.Pod) metav1.DeleteOptions {
+	options := metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(pod.UID))}
+	if r.opts.DrainPeriod > 0 {
+		grace := int64(r.opts.DrainPeriod.Seconds())
+		options.GracePeriodSeconds = &grace
+	}
+	return options
+}
+
+func (r *Restarter) waitForDisruptionBudgets(ctx context.Context, w *Workload, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		lastErr = r.checkDisruptionBudgets(ctx, w)
+		return lastErr == nil, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for disruption budget: %v", timeout, lastErr)
+	}
+	return err
+}
+
+func (r *Restarter) waitForPodGone(ctx context.Context, namespace, name string, uid types.UID, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return pod.UID != uid, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for pod %s/%s to terminate", timeout, namespace, name)
+	}
+	return err
+}
+
+func (r *Restarter) waitForReplicasReady(ctx context.Context, w *Workload, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, false, func(ctx context.Context) (bool, error) {
+		status, err := r.RolloutStatus(ctx, w.Kind, w.Namespace, w.Name)
+		if err != nil {
+			return false, err
+		}
+		return status.Complete && status.Ready >= status.Desired, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for a replacement pod of %s to become ready", timeout, w)
+	}
+	return err
+}
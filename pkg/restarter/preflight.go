@@ -0,0 +1,100 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// Kubernetes minor versions this package supports: 1.21 is the first with
+// policy/v1 PodDisruptionBudgets and evictions, and client-go is only
+// tested against one minor version newer than itself.
+const (
+	minServerMinor = 21
+	maxServerMinor = 31
+)
+
+// Preflight checks that the API server is reachable and accepts our
+// credentials, serves apps/v1 and runs a supported Kubernetes version, and
+// that the custom resources the options rely on, together with required,
+// are installed. A server newer than the supported range is only warned
+// about.
+func (r *Restarter) Preflight(ctx context.Context, required ...schema.GroupVersionResource) error {
+	info, err := r.serverVersion(ctx)
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return fmt.Errorf("the API server rejected the credentials, check the kubeconfig user or token: %w", err)
+	case apierrors.IsForbidden(err):
+		return fmt.Errorf("the API server refused access to its version, check the impersonated user and RBAC: %w", err)
+	case err != nil:
+		return fmt.Errorf("the API server is unreachable, check the kubeconfig context and that the cluster is running: %w", err)
+	}
+
+	minor, err := strconv.Atoi(strings.TrimRight(info.Minor, "+"))
+	if err != nil || info.Major != "1" {
+		r.log.Warn("Could not parse the Kubernetes version, assuming it is supported", "version", info.GitVersion)
+	} else if minor < minServerMinor {
+		return fmt.Errorf("kubernetes %s is not supported, 1.%d or newer is required", info.GitVersion, minServerMinor)
+	} else if minor > maxServerMinor {
+		r.log.Warn("Kubernetes version is newer than the ones this tool was tested with", "version", info.GitVersion, "newestTested", fmt.Sprintf("1.%d", maxServerMinor))
+	}
+	r.log.Debug("API server reachable", "version", info.GitVersion)
+
+	if err := r.requireResource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}); err != nil {
+		return err
+	}
+	if r.opts.Backup == "velero" {
+		required = append(required, veleroBackupResource)
+	}
+	if r.opts.MemoryAbove.set() || r.opts.CPUAbove.set() {
+		if err := r.requireResource(podMetricsResource); err != nil {
+			return fmt.Errorf("usage thresholds need metrics-server: %w", err)
+		}
+	}
+	for _, resource := range required {
+		if err := r.requireResource(resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Restarter) serverVersion(ctx context.Context) (*version.Info, error) {
+	client := r.clientset.Discovery().RESTClient()
+	if client == nil {
+		// Fake clientsets have no REST client.
+		return r.clientset.Discovery().ServerVersion()
+	}
+	body, err := client.Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	info := &version.Info{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, fmt.Errorf("decoding the server version: %w", err)
+	}
+	return info, nil
+}
+
+func (r *Restarter) requireResource(resource schema.GroupVersionResource) error {
+	groupVersion := resource.GroupVersion().String()
+	list, err := r.clientset.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("the API server does not serve %s, is its CRD installed?", groupVersion)
+	}
+	if err != nil {
+		return fmt.Errorf("looking up %s: %w", groupVersion, err)
+	}
+	for _, apiResource := range list.APIResources {
+		if apiResource.Name == resource.Resource {
+			return nil
+		}
+	}
+	return fmt.Errorf("the API server does not serve %s in %s, is its CRD installed?", resource.Resource, groupVersion)
+}
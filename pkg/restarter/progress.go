@@ -0,0 +1,20 @@
+package restarter
+
+import "time"
+
+// Progress is a snapshot of one workload's restart, passed to
+// Options.OnProgress as the restart moves through its phases.
+type Progress struct {
+	Workload string
+	// Phase is checking images, backing up, canary, restarting, waiting, verifying, succeeded or failed.
+	Phase   string
+	Rollout *RolloutStatus
+	Started time.Time
+}
+
+func (r *Restarter) reportProgress(w *Workload, phase string, rollout *RolloutStatus, start time.Time) {
+	if r.opts.OnProgress == nil {
+		return
+	}
+	r.opts.OnProgress(Progress{Workload: w.String(), Phase: phase, Rollout: rollout, Started: start})
+}
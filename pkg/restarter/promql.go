@@ -0,0 +1,195 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// promQLGateInterval is how often a PromQL gate that is not satisfied is
+// queried again, about a Prometheus scrape interval.
+const promQLGateInterval = 15 * time.Second
+
+// ErrGateNotSatisfied is returned for workloads whose PromQL gate did not
+// pass before its timeout.
+var ErrGateNotSatisfied = errors.New("promql gate not satisfied")
+
+var promQLConditionPattern = regexp.MustCompile(`^(.*\S)\s*(<=|>=|==|!=|<|>)\s*([-+]?[0-9.]+(?:[eE][-+]?[0-9]+)?)$`)
+
+// PromQLGate holds each workload's restart until a PromQL query satisfies
+// a condition: every sample of its result compares to Threshold with Op.
+type PromQLGate struct {
+	// Server is the base URL of the Prometheus API, e.g.
+	// http://prometheus.monitoring:9090.
+	Server string
+	// Query is executed with the workload's MessageData, so it can select
+	// the workload's series, e.g. pg_replication_lag{namespace="{{.Namespace}}"}.
+	Query     *template.Template
+	Op        string
+	Threshold float64
+	// Timeout is how long to keep querying while the condition is not met
+	// before failing the workload; zero queries once.
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// ParsePromQLGate parses QUERY OP THRESHOLD, such as
+// `max(pg_replication_lag_seconds{namespace="{{.Namespace}}"}) < 10`, where
+// OP is one of <, <=, >, >=, == and !=.
+func ParsePromQLGate(raw string) (*PromQLGate, error) {
+	m := promQLConditionPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return nil, fmt.Errorf("invalid promql gate %q: must be QUERY OP THRESHOLD, e.g. \"pg_replication_lag < 10\"", raw)
+	}
+	threshold, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid promql gate threshold %q: %w", m[3], err)
+	}
+	query, err := template.New("promql-gate").Option("missingkey=error").Parse(m[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid promql gate query: %w", err)
+	}
+	return &PromQLGate{Query: query, Op: m[2], Threshold: threshold}, nil
+}
+
+func (g *PromQLGate) compare(value float64) bool {
+	switch g.Op {
+	case "<":
+		return value < g.Threshold
+	case "<=":
+		return value <= g.Threshold
+	case ">":
+		return value > g.Threshold
+	case ">=":
+		return value >= g.Threshold
+	case "==":
+		return value == g.Threshold
+	case "!=":
+		return value != g.Threshold
+	}
+	return false
+}
+
+// checkGate waits for the PromQLGate of w to pass, querying again every
+// promQLGateInterval until its Timeout.
+func (r *Restarter) checkGate(ctx context.Context, w *Workload) error {
+	g := r.opts.PromQLGate
+	var b strings.Builder
+	if err := g.Query.Execute(&b, r.messageData(ctx, w)); err != nil {
+		return fmt.Errorf("rendering the promql gate query: %w", err)
+	}
+	query := b.String()
+
+	var reason string
+	check := func(ctx context.Context) (bool, error) {
+		var err error
+		reason, err = g.evaluate(ctx, query)
+		if err != nil {
+			return false, err
+		}
+		if reason != "" {
+			r.log.Info("PromQL gate not satisfied", "workload", w.String(), "query", query, "reason", reason)
+		}
+		return reason == "", nil
+	}
+	if g.Timeout <= 0 {
+		ok, err := check(ctx)
+		if err == nil && !ok {
+			err = fmt.Errorf("%w: %s", ErrGateNotSatisfied, reason)
+		}
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+	err := wait.PollUntilContextCancel(ctx, promQLGateInterval, true, check)
+	if wait.Interrupted(err) && reason != "" {
+		return fmt.Errorf("%w after %s: %s", ErrGateNotSatisfied, g.Timeout, reason)
+	}
+	return err
+}
+
+// evaluate runs query and returns why its result does not satisfy the
+// condition, or an empty string if it does.
+func (g *PromQLGate) evaluate(ctx context.Context, query string) (string, error) {
+	endpoint := strings.TrimSuffix(g.Server, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("querying prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("querying prometheus: %w", err)
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("querying prometheus: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if result.Status != "success" {
+		return "", fmt.Errorf("querying prometheus: %s", result.Error)
+	}
+
+	var values []string
+	switch result.Data.ResultType {
+	case "scalar":
+		var sample [2]any
+		if err := json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return "", fmt.Errorf("decoding the prometheus result: %w", err)
+		}
+		value, _ := sample[1].(string)
+		values = append(values, value)
+	case "vector":
+		var samples []struct {
+			Value [2]any `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &samples); err != nil {
+			return "", fmt.Errorf("decoding the prometheus result: %w", err)
+		}
+		for _, s := range samples {
+			value, _ := s.Value[1].(string)
+			values = append(values, value)
+		}
+	default:
+		return "", fmt.Errorf("promql gate query returned a %s, not a scalar or instant vector", result.Data.ResultType)
+	}
+	if len(values) == 0 {
+		return "query returned no samples", nil
+	}
+	for _, raw := range values {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return "", fmt.Errorf("decoding the prometheus result: %w", err)
+		}
+		if !g.compare(value) {
+			return fmt.Sprintf("%s is not %s %s", raw, g.Op, strconv.FormatFloat(g.Threshold, 'g', -1, 64)), nil
+		}
+	}
+	return "", nil
+}
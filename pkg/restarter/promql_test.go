@@ -0,0 +1,67 @@
+package restarter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePromQLGate(t *testing.T) {
+	tests := []struct {
+		raw       string
+		query     string
+		op        string
+		threshold float64
+		wantErr   bool
+	}{
+		{raw: "pg_replication_lag < 10", query: "pg_replication_lag", op: "<", threshold: 10},
+		{raw: "  up==1  ", query: "up", op: "==", threshold: 1},
+		{raw: `max(lag{namespace="{{.Namespace}}"}) <= 2.5`, query: `max(lag{namespace="prod"})`, op: "<=", threshold: 2.5},
+		{raw: "rate(errors[5m]) >= -1e-3", query: "rate(errors[5m])", op: ">=", threshold: -1e-3},
+		{raw: "connections != 0", query: "connections", op: "!=", threshold: 0},
+		{raw: "pg_replication_lag", wantErr: true},
+		{raw: "< 10", wantErr: true},
+		{raw: "lag < ten", wantErr: true},
+		{raw: "lag < 1.2.3", wantErr: true},
+		{raw: "{{.Namespace < 10", wantErr: true},
+	}
+	for _, tt := range tests {
+		gate, err := ParsePromQLGate(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePromQLGate(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var query strings.Builder
+		if err := gate.Query.Execute(&query, MessageData{Namespace: "prod"}); err != nil {
+			t.Errorf("ParsePromQLGate(%q) query: %v", tt.raw, err)
+		}
+		if query.String() != tt.query || gate.Op != tt.op || gate.Threshold != tt.threshold {
+			t.Errorf("ParsePromQLGate(%q) = %q %s %v, want %q %s %v", tt.raw, query.String(), gate.Op, gate.Threshold, tt.query, tt.op, tt.threshold)
+		}
+	}
+}
+
+func TestPromQLGateCompare(t *testing.T) {
+	tests := []struct {
+		op    string
+		value float64
+		want  bool
+	}{
+		{"<", 9, true},
+		{"<", 10, false},
+		{"<=", 10, true},
+		{">", 10, false},
+		{">=", 10, true},
+		{"==", 10, true},
+		{"!=", 10, false},
+		{"~", 10, false},
+	}
+	for _, tt := range tests {
+		g := &PromQLGate{Op: tt.op, Threshold: 10}
+		if got := g.compare(tt.value); got != tt.want {
+			t.Errorf("%v %s 10 = %t, want %t", tt.value, tt.op, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Karmada marks the copies it propagates to member clusters; their resource
+// template, with the same namespace and name, lives in the Karmada control
+// plane, which reverts changes made to a copy.
+const (
+	karmadaManagedLabel   = "karmada.io/managed"
+	karmadaWorkAnnotation = "work.karmada.io/name"
+)
+
+var templateResources = map[string]schema.GroupVersionResource{
+	"Deployment":  appsv1.SchemeGroupVersion.WithResource("deployments"),
+	"StatefulSet": appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+	"DaemonSet":   appsv1.SchemeGroupVersion.WithResource("daemonsets"),
+}
+
+// propagated reports whether obj is a copy propagated by Karmada.
+func propagated(obj metav1.Object) bool {
+	_, work := obj.GetAnnotations()[karmadaWorkAnnotation]
+	return obj.GetLabels()[karmadaManagedLabel] == "true" || work
+}
+
+// restartPropagated restarts w through its resource template in the Karmada
+// control plane and waits for the change to reach the local copy, so the
+// rollout that follows is the one the restart started.
+func (r *Restarter) restartPropagated(ctx context.Context, w *Workload, audit map[string]string) error {
+	resource := templateResources[w.Kind]
+	annotations := map[string]any{}
+	for k, v := range audit {
+		annotations[k] = v
+	}
+	template := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": resource.GroupVersion().String(),
+		"kind":       w.Kind,
+		"metadata": map[string]any{
+			"name":      w.Name,
+			"namespace": w.Namespace,
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{"annotations": annotations},
+			},
+		},
+	}}
+	if _, err := r.opts.Federation.Resource(resource).Namespace(w.Namespace).Apply(ctx, w.Name, template, applyOptions); err != nil {
+		return fmt.Errorf("patching the resource template in the control plane: %w", err)
+	}
+
+	r.log.Info("Waiting for the restart to propagate", "workload", w.String())
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		obj, err := r.getWorkloadMeta(ctx, w)
+		if err != nil {
+			return false, err
+		}
+		return podTemplateAnnotations(obj)[restartedAtAnnotation] == audit[restartedAtAnnotation], nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for the restart of %s to propagate from the control plane", r.opts.Timeout, w)
+	}
+	return err
+}
+
+func podTemplateAnnotations(obj metav1.Object) map[string]string {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Template.Annotations
+	case *appsv1.StatefulSet:
+		return obj.Spec.Template.Annotations
+	case *appsv1.DaemonSet:
+		return obj.Spec.Template.Annotations
+	}
+	return nil
+}
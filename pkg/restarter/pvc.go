@@ -0,0 +1,72 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const betaStorageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+
+// selectClaims resolves StorageClasses to the claims in namespaces that
+// belong to them, keyed by namespace/name. It leaves r.claims nil when no
+// storage class is set.
+func (r *Restarter) selectClaims(ctx context.Context, namespaces []string) error {
+	if len(r.opts.StorageClasses) == 0 {
+		return nil
+	}
+
+	claims := map[string]string{}
+	for _, namespace := range namespaces {
+		list, err := r.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("listing persistent volume claims: %w", err)
+		}
+		for i := range list.Items {
+			claim := &list.Items[i]
+			if class := claimStorageClass(claim); slices.Contains(r.opts.StorageClasses, class) {
+				claims[claim.Namespace+"/"+claim.Name] = class
+			}
+		}
+	}
+	if len(claims) == 0 {
+		r.log.Warn("No persistent volume claims use the storage classes", "storageClasses", strings.Join(r.opts.StorageClasses, ","))
+	}
+	r.claims = claims
+	return nil
+}
+
+func claimStorageClass(claim *corev1.PersistentVolumeClaim) string {
+	if claim.Spec.StorageClassName != nil {
+		return *claim.Spec.StorageClassName
+	}
+	return claim.Annotations[betaStorageClassAnnotation]
+}
+
+// matchClaims reports whether pod mounts one of PVCs, given as NAME or
+// NAMESPACE/NAME, or a claim of one of StorageClasses.
+func (r *Restarter) matchClaims(pod *corev1.Pod) (string, bool) {
+	for _, volume := range pod.Spec.Volumes {
+		var claim string
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			claim = volume.PersistentVolumeClaim.ClaimName
+		case volume.Ephemeral != nil:
+			// Generic ephemeral volumes get a claim named after the pod and volume.
+			claim = pod.Name + "-" + volume.Name
+		default:
+			continue
+		}
+		if slices.Contains(r.opts.PVCs, claim) || slices.Contains(r.opts.PVCs, pod.Namespace+"/"+claim) {
+			return "mounts claim " + claim, true
+		}
+		if class, ok := r.claims[pod.Namespace+"/"+claim]; ok {
+			return fmt.Sprintf("mounts claim %s of storage class %s", claim, class), true
+		}
+	}
+	return "", false
+}
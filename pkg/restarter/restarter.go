@@ -0,0 +1,833 @@
+// Package restarter finds the workloads behind matching pods and rollout
+// restarts them, the same way the my-k8s-redeploy command does.
+package restarter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/pager"
+)
+
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	enabledAnnotation     = "restart-tool/enabled"
+	policyAnnotation      = "restart-tool/policy"
+
+	reasonAnnotation    = "restart-tool/reason"
+	initiatorAnnotation = "restart-tool/initiator"
+	runIDAnnotation     = "restart-tool/run-id"
+)
+
+// FieldManager owns the fields this package writes, so server-side apply and
+// managedFields attribute them to the restarter.
+const FieldManager = "database-restarter"
+
+var applyOptions = metav1.ApplyOptions{FieldManager: FieldManager, Force: true}
+
+// Options controls which pods match and how their workloads are restarted.
+type Options struct {
+	Selector      string
+	FieldSelector string
+	// Patterns match pod names; a pod must match at least one when any are set.
+	Patterns []NamePattern
+	// ImagePatterns match container images, either the full reference or its
+	// last path segment (postgres:14.5 for docker.io/library/postgres:14.5);
+	// a pod must have a container matching one of them when any are set.
+	ImagePatterns []NamePattern
+	// HelmReleases limit matching pods to those labeled as part of one of
+	// these releases; workloads Helm installed for another release are
+	// skipped.
+	HelmReleases []string
+	// Expressions are CEL expressions a pod must all satisfy.
+	Expressions []PodExpression
+
+	// MinRestarts, LastState and OlderThan further limit matching pods to
+	// those with a container restarted at least MinRestarts times, with a
+	// container whose last termination reason is LastState (such as
+	// OOMKilled), and started more than OlderThan ago.
+	MinRestarts int32
+	LastState   string
+	OlderThan   time.Duration
+
+	// MemoryAbove and CPUAbove limit matching pods to those with a
+	// container whose memory, or CPU, usage in the metrics API is above
+	// the threshold.
+	MemoryAbove UsageThreshold
+	CPUAbove    UsageThreshold
+
+	// Nodes and NodeSelector limit matching pods to those scheduled on the
+	// named nodes or on nodes with matching labels.
+	Nodes        []string
+	NodeSelector string
+
+	// PVCs and StorageClasses limit matching pods to those mounting one of
+	// the named PersistentVolumeClaims, as NAME or NAMESPACE/NAME, or a
+	// claim of one of the storage classes.
+	PVCs           []string
+	StorageClasses []string
+
+	// ExcludeNamespaces are globs; pods in matching namespaces never match.
+	// Exclude protects matching workloads regardless of Selector and Patterns.
+	ExcludeNamespaces []string
+	Exclude           []WorkloadPattern
+
+	// IfChanged, when set, limits the plan to workloads whose
+	// restart-tool/config-hash annotation differs from the hash of these
+	// ConfigMaps and Secrets in their namespace; the new hash is recorded
+	// once the restart succeeds.
+	IfChanged []ConfigRef
+
+	// Consumers are scaled to zero before the first restart and back to
+	// their replicas once every workload is done, so their clients do not
+	// all reconnect to a primary as soon as it is back.
+	Consumers []Consumer
+
+	// CustomOwners let pods controlled, directly or through a StatefulSet,
+	// Deployment or DaemonSet, by other kinds be restarted through them.
+	CustomOwners []CustomOwner
+
+	// Ordered restarts StatefulSets by deleting pods one at a time from the
+	// highest ordinal. RoleLabel implies it and moves replicas to the front
+	// and pods whose RoleLabel value is one of PrimaryRoles to the back;
+	// SwitchoverHook, when set, runs in each primary just before it is
+	// deleted.
+	Ordered        bool
+	RoleLabel      string
+	PrimaryRoles   []string
+	SwitchoverHook PodHook
+
+	// CaughtUp, when set, is retried against each pod an ordered or
+	// partitioned StatefulSet restart replaces, once it is ready, until it
+	// passes or CaughtUpTimeout (default Timeout) elapses, so the next
+	// replica is not taken down while this one still resyncs.
+	CaughtUp        HealthCheck
+	CaughtUpTimeout time.Duration
+
+	// Partitioned restarts RollingUpdate StatefulSets by raising their
+	// partition to their replicas and lowering it one ordinal at a time,
+	// waiting for each pod to be updated, ready and to pass HealthCheck. An
+	// interrupted partitioned restart resumes where it stopped.
+	Partitioned bool
+
+	// DrainPeriod replaces the termination grace period of the pods deleted
+	// or evicted directly (by the delete-pods and evict strategies, Ordered,
+	// RoleLabel, Canary, and for OnDelete StatefulSets and InnoDBClusters), so
+	// long-running connections can drain. Rollout restarts leave pod
+	// termination to the workload's controller.
+	DrainPeriod time.Duration
+
+	Force       bool
+	Wait        bool
+	Timeout     time.Duration
+	Concurrency int
+
+	// WorkloadTimeout, when set, bounds everything done to a single
+	// workload, from its pre-restart checks to its post-hook, so a rollout
+	// that never finishes fails that workload instead of holding up the run.
+	WorkloadTimeout time.Duration
+	Interval        time.Duration
+	DryRun          bool
+
+	// Strategy is "rollout" (the default), which restarts the whole workload,
+	// "delete-pods", which deletes only the matching pods one at a time, or
+	// "evict", which evicts them through the Eviction API so the API server
+	// enforces PodDisruptionBudgets, or "scale-bounce", which scales
+	// Deployments and StatefulSets to zero and back once their pods are gone
+	// and restarts other kinds as "rollout" does. Jobs and CronJobs are always
+	// recreated or triggered.
+	Strategy string
+
+	// OnError is what a failed workload restart does to the rest of the
+	// plan: "continue" (the default) restarts the others anyway and only
+	// stops after a failed health check, "stop" restarts no more workloads,
+	// and "rollback" also rolls back the Deployments already restarted, and
+	// the one that failed, to their previous revision.
+	OnError string
+
+	// Cooldown skips workloads whose restartedAt annotation, or spec.restartAt
+	// for Argo Rollouts, is more recent than this.
+	Cooldown time.Duration
+
+	// ResumePaused restarts paused Deployments by resuming them, waiting
+	// for the rollout and pausing them again. Without it they are skipped,
+	// since their rollout would not start until someone resumed them.
+	ResumePaused bool
+
+	// AuditLog, when set, names a ConfigMap in each namespace to which
+	// every restart appends a RestartRecord, keeping the most recent ones.
+	AuditLog string
+
+	// Cache, when set, serves pods, ReplicaSets, Deployments and
+	// StatefulSets from its informers instead of the API server. Pods are
+	// still listed from the API server with a FieldSelector.
+	Cache *Cache
+
+	// Retry retries the requests of the clients NewForConfig builds.
+	Retry RetryPolicy
+
+	// Federation is a client for the Karmada control plane. Workloads it
+	// propagates are restarted by patching their resource template there,
+	// since it reverts changes to the local copy; without it they are skipped.
+	Federation dynamic.Interface
+
+	// ArgoCD, when set, restarts Deployments, StatefulSets and DaemonSets
+	// managed by one of its Applications through the Application's restart
+	// action instead of patching them. Other workloads applied by Argo CD or
+	// Flux are patched with a warning that the change shows as drift.
+	ArgoCD *ArgoCD
+
+	// PromQLGate, when set, holds each restart until its query satisfies
+	// its condition, and fails the workload if it does not in time.
+	PromQLGate *PromQLGate
+
+	// Canary, for workloads restarted by a rollout, first replaces a single
+	// matching pod and waits for its replacement to become ready and pass
+	// HealthCheck before restarting the rest.
+	Canary bool
+
+	// Order chains restart workloads matching an earlier pattern, and wait for
+	// their rollouts, before those matching a later one, in addition to the
+	// restart-tool/depends-on annotations. Dependents of a workload that fails
+	// are not restarted.
+	Order [][]WorkloadPattern
+
+	// BatchSize splits the plan into waves of this many workloads that are
+	// restarted together; the next wave starts Stagger after the previous
+	// one has finished, including its rollouts when Wait is set.
+	BatchSize int
+	Stagger   time.Duration
+
+	// HealthCheck, when set, must pass on every ready pod of a workload after
+	// its rollout before the restart counts as succeeded. A failing check
+	// stops RestartAll from starting any further restarts.
+	HealthCheck HealthCheck
+
+	// CheckImages pulls the images of each workload's pod template in a
+	// short-lived pod before restarting it, and fails the workload without
+	// restarting it when one of them cannot be pulled within Timeout.
+	CheckImages bool
+
+	// Backup is "velero", to back up each workload's namespace with a Velero
+	// Backup in VeleroNamespace, or "operator", to take a backup through a
+	// database operator cluster's own backup resource, before restarting.
+	// BackupStorage names the storage (Percona) or backup profile (Oracle
+	// MySQL) to use. A backup that fails or does not finish within
+	// BackupTimeout fails the workload without restarting it.
+	Backup          string
+	BackupStorage   string
+	VeleroNamespace string
+	BackupTimeout   time.Duration
+
+	// PreHook runs in each matched pod that is still running before its
+	// workload is restarted; an error fails the workload without restarting it.
+	PreHook PodHook
+
+	// PostHook is retried in every ready pod of a workload after its rollout
+	// until it succeeds in all of them or PostHookTimeout (default Timeout)
+	// elapses, which counts as a failed health check.
+	PostHook        PodHook
+	PostHookTimeout time.Duration
+
+	// Reason is recorded in the restart-tool/reason annotation of every
+	// restarted workload instead of the reason its pods matched.
+	Reason string
+	// ReasonTemplate and EventTemplate, when set, render the reason
+	// annotation and the message of the restart event from MessageData.
+	ReasonTemplate *template.Template
+	EventTemplate  *template.Template
+	// RunID is recorded in the restart-tool/run-id annotation so all
+	// workloads restarted together can be found later; defaults to NewRunID().
+	RunID string
+
+	// OnProgress, when set, is called from the restart workers as each
+	// workload starts, while its rollout is being waited for, and when it
+	// finishes. It must be safe for concurrent use.
+	OnProgress func(Progress)
+
+	// RestartThreshold and WatchCooldown only apply to Watch.
+	RestartThreshold int32
+	WatchCooldown    time.Duration
+
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Restarter plans and performs workload restarts against a single cluster.
+type Restarter struct {
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	opts      Options
+	log       *slog.Logger
+
+	initiatorOnce sync.Once
+	initiatorName string
+
+	resourcesMu sync.Mutex
+	resources   map[string]schema.GroupVersionResource
+
+	backupsMu sync.Mutex
+	backups   map[string]error
+
+	// nodes holds the names of the nodes Nodes and NodeSelector select, once
+	// resolved by selectNodes.
+	nodes map[string]bool
+	// claims maps the namespace/name of the claims StorageClasses select to
+	// their storage class, once resolved by selectClaims.
+	claims map[string]string
+	// usage holds the resource usage of each container by namespace/pod,
+	// once fetched by selectUsage.
+	usage map[string]map[string]corev1.ResourceList
+}
+
+// NewForConfig creates a Restarter with clients built from config, whose
+// requests are retried by opts.Retry.
+func NewForConfig(config *rest.Config, opts Options) (*Restarter, error) {
+	config = WithRetry(config, opts.Retry, opts.Logger)
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(clientset, dynamicClient, opts), nil
+}
+
+// New creates a Restarter that uses the given clients, such as the ones from
+// k8s.io/client-go/kubernetes/fake and k8s.io/client-go/dynamic/fake in tests.
+func New(clientset kubernetes.Interface, dynamicClient dynamic.Interface, opts Options) *Restarter {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.RunID == "" {
+		opts.RunID = NewRunID()
+	}
+	if opts.VeleroNamespace == "" {
+		opts.VeleroNamespace = "velero"
+	}
+	if opts.BackupTimeout <= 0 {
+		opts.BackupTimeout = 30 * time.Minute
+	}
+	return &Restarter{clientset: clientset, dynamic: dynamicClient, opts: opts, log: opts.Logger, resources: map[string]schema.GroupVersionResource{}, backups: map[string]error{}}
+}
+
+// NewRunID returns an identifier for a restart run, such as 20240102-030405-x7k2q.
+func NewRunID() string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + rand.String(5)
+}
+
+// RunID returns the identifier recorded on the workloads this Restarter restarts.
+func (r *Restarter) RunID() string {
+	return r.opts.RunID
+}
+
+// podPageSize is how many pods a list request returns at most. Pods are
+// listed a page at a time and only the matching ones kept, so listing every
+// pod of a large cluster does not hold them all in memory at once.
+const podPageSize = 500
+
+// ListPods lists the pods in namespaces that match the label and field
+// selectors and MatchPod.
+func (r *Restarter) ListPods(ctx context.Context, namespaces []string) (pods *corev1.PodList, err error) {
+	ctx, span := tracer.Start(ctx, "list pods", trace.WithAttributes(attribute.StringSlice("k8s.namespace.names", namespaces)))
+	defer func() { endSpan(span, err) }()
+
+	if err := r.selectNodes(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.selectClaims(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	if err := r.selectUsage(ctx, namespaces); err != nil {
+		return nil, err
+	}
+	pods = &corev1.PodList{}
+	for _, namespace := range namespaces {
+		if r.opts.Cache.covers(namespace) && r.opts.FieldSelector == "" {
+			if err := r.listCachedPods(namespace, pods); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, fieldSelector := range r.fieldSelectors() {
+			lister := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+				return r.clientset.CoreV1().Pods(namespace).List(ctx, opts)
+			}))
+			lister.PageSize = podPageSize
+			err := lister.EachListItem(ctx, metav1.ListOptions{LabelSelector: r.labelSelector(), FieldSelector: fieldSelector}, func(obj runtime.Object) error {
+				pod := obj.(*corev1.Pod)
+				if _, ok := r.MatchPod(pod); !ok {
+					r.log.Debug("Pod did not match", "pod", pod.Namespace+"/"+pod.Name)
+					return nil
+				}
+				pod.ManagedFields = nil
+				pods.Items = append(pods.Items, *pod)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("k8s.pods", len(pods.Items)))
+
+	return pods, nil
+}
+
+// maxSplitLists bounds how many list requests per namespace plain name
+// patterns or selected nodes are split into; beyond it they are matched
+// client-side instead.
+const maxSplitLists = 20
+
+// fieldSelectors returns the field selectors to list pods with. When every
+// pattern is a plain name, or few nodes are selected, FieldSelector is
+// narrowed to one request per name or node, so the API server only returns
+// pods that can match instead of every pod of the namespace.
+func (r *Restarter) fieldSelectors() []string {
+	var split []string
+	names := make([]string, 0, len(r.opts.Patterns))
+	for _, p := range r.opts.Patterns {
+		if name, ok := p.literal(); ok {
+			names = append(names, name)
+		}
+	}
+	switch {
+	case len(names) > 0 && len(names) == len(r.opts.Patterns) && len(names) <= maxSplitLists:
+		for _, name := range names {
+			split = append(split, "metadata.name="+name)
+		}
+	case r.nodes != nil && len(r.nodes) > 0 && len(r.nodes) <= maxSplitLists:
+		for node := range r.nodes {
+			split = append(split, "spec.nodeName="+node)
+		}
+		sort.Strings(split)
+	default:
+		return []string{r.opts.FieldSelector}
+	}
+
+	if r.opts.FieldSelector != "" {
+		for i := range split {
+			split[i] = r.opts.FieldSelector + "," + split[i]
+		}
+	}
+	return split
+}
+
+// RestartAll restarts every workload in plan, each only after the workloads
+// it depends on, and returns the ones that failed or were not restarted
+// because a dependency failed.
+func (r *Restarter) RestartAll(ctx context.Context, plan []*Workload) []*Workload {
+	if len(r.opts.Consumers) > 0 && len(plan) > 0 {
+		resume, err := r.pauseConsumers(ctx)
+		defer resume()
+		if err != nil {
+			r.log.Error("Not restarting, consumers could not be scaled down", "error", err)
+			for _, w := range plan {
+				w.Result = "failed"
+				w.Error = "consumers were not scaled down: " + err.Error()
+			}
+			return plan
+		}
+	}
+
+	var failed []*Workload
+	var halted atomic.Bool
+	for _, level := range dependencyLevels(plan) {
+		if halted.Load() || ctx.Err() != nil {
+			break
+		}
+		var ready []*Workload
+		for _, w := range level {
+			if dep := failedDependency(w); dep != nil {
+				r.log.Error("Not restarting workload, a dependency was not restarted", "workload", w.String(), "dependency", dep.String())
+				w.Result = "skipped"
+				w.Error = "dependency " + dep.String() + " was not restarted"
+				failed = append(failed, w)
+				continue
+			}
+			ready = append(ready, w)
+		}
+		failed = append(failed, r.restartBatches(ctx, ready, &halted)...)
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.skipUnstarted(plan, "not restarted, deadline exceeded")
+		r.log.Warn("Stopped restarting because the run's deadline was exceeded")
+	case ctx.Err() != nil:
+		r.skipUnstarted(plan, "not restarted, interrupted")
+		r.log.Warn("Stopped restarting because the run was interrupted")
+	case halted.Load() && r.opts.OnError != "" && r.opts.OnError != "continue":
+		r.skipUnstarted(plan, "not restarted after an earlier failure")
+		r.log.Error("Stopped restarting after a failure", "onError", r.opts.OnError)
+	case halted.Load():
+		r.skipUnstarted(plan, "not restarted after an earlier health check failed")
+		r.log.Error("Stopped restarting after a failed health check")
+	}
+	if halted.Load() && r.opts.OnError == "rollback" {
+		r.rollbackRestarted(ctx, plan)
+	}
+	if len(failed) > 0 {
+		r.log.Error("Some workloads failed to restart", "failed", len(failed), "total", len(plan))
+		for _, w := range failed {
+			r.log.Error("Workload failed", "workload", w.String(), "error", w.Error)
+		}
+	}
+	return failed
+}
+
+func (r *Restarter) restartBatches(ctx context.Context, plan []*Workload, halted *atomic.Bool) []*Workload {
+	var failed []*Workload
+	if r.opts.BatchSize < 1 {
+		failed = r.restartWave(ctx, plan, r.opts.Concurrency, halted)
+	} else {
+		waves := (len(plan) + r.opts.BatchSize - 1) / r.opts.BatchSize
+		for i := 0; i < waves && !halted.Load() && ctx.Err() == nil; i++ {
+			if i > 0 && r.opts.Stagger > 0 {
+				r.log.Info("Pausing before next wave", "stagger", r.opts.Stagger)
+				if !sleep(ctx, r.opts.Stagger) {
+					break
+				}
+			}
+			wave := plan[i*r.opts.BatchSize : min((i+1)*r.opts.BatchSize, len(plan))]
+			r.log.Info("Starting restart wave", "wave", i+1, "waves", waves, "workloads", len(wave))
+			failed = append(failed, r.restartWave(ctx, wave, len(wave), halted)...)
+		}
+	}
+	return failed
+}
+
+func (r *Restarter) restartWave(ctx context.Context, plan []*Workload, workers int, halted *atomic.Bool) []*Workload {
+	var mu sync.Mutex
+	var failed []*Workload
+	var wg sync.WaitGroup
+	queue := make(chan *Workload)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range queue {
+				if err := r.Restart(ctx, w); err != nil {
+					if errors.Is(err, ErrHealthCheckFailed) || r.opts.OnError == "stop" || r.opts.OnError == "rollback" {
+						halted.Store(true)
+					}
+					mu.Lock()
+					failed = append(failed, w)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i, w := range plan {
+		if i > 0 && r.opts.Interval > 0 && !sleep(ctx, wait.Jitter(r.opts.Interval, 0.25)) {
+			break
+		}
+		if halted.Load() || ctx.Err() != nil {
+			break
+		}
+		queue <- w
+	}
+	close(queue)
+	wg.Wait()
+	return failed
+}
+
+func (r *Restarter) skipUnstarted(plan []*Workload, reason string) {
+	for _, w := range plan {
+		if w.Result == "" {
+			w.Result = "skipped"
+			w.Error = reason
+		}
+	}
+}
+
+// sleep waits for d and reports false if ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+var errWorkloadTimeout = errors.New("workload timeout exceeded")
+
+// Restart restarts a single workload and records the outcome on it.
+func (r *Restarter) Restart(ctx context.Context, w *Workload) error {
+	ctx, span := tracer.Start(ctx, "restart", workloadAttributes(w))
+	if r.opts.AuditLog != "" {
+		// Recorded however the restart ends, even if the run is interrupted.
+		defer r.recordAudit(context.WithoutCancel(ctx), w, time.Now())
+	}
+	if r.opts.WorkloadTimeout <= 0 {
+		err := r.restart(ctx, w)
+		endSpan(span, err)
+		return err
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, r.opts.WorkloadTimeout, errWorkloadTimeout)
+	defer cancel()
+	err := r.restart(ctx, w)
+	// Whichever step was running reports its own, shorter, timeout.
+	if err != nil && context.Cause(ctx) == errWorkloadTimeout {
+		err = fmt.Errorf("%s did not finish restarting within %s: %w", w, r.opts.WorkloadTimeout, err)
+		w.Error = err.Error()
+	}
+	endSpan(span, err)
+	return err
+}
+
+func (r *Restarter) restart(ctx context.Context, w *Workload) error {
+	r.log.Info("Restarting workload", "workload", w.String(), "action", w.Action, "pods", strings.Join(w.Pods, ","))
+	start := time.Now()
+	var rollout *RolloutStatus
+	r.reportProgress(w, "restarting", nil, start)
+	defer func() { r.reportProgress(w, w.Result, rollout, start) }()
+
+	// Evictions are checked against the budgets by the API server instead.
+	if w.Action != "evict" {
+		if err := r.checkDisruptionBudgets(ctx, w); err != nil {
+			if !r.opts.Force {
+				r.log.Error("Refusing to restart workload, use --force to override", "workload", w.String(), "error", err)
+				w.fail(err, start)
+				return err
+			}
+			r.log.Warn("Continuing despite disruption budget because --force is set", "workload", w.String(), "error", err)
+		}
+	}
+
+	if r.opts.CheckImages {
+		r.reportProgress(w, "checking images", nil, start)
+		if err := r.checkImages(ctx, w); err != nil {
+			r.log.Error("Image check failed, not restarting", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+
+	if r.opts.Backup != "" {
+		r.reportProgress(w, "backing up", nil, start)
+		if err := r.backup(ctx, w); err != nil {
+			r.log.Error("Backup failed, not restarting", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if r.opts.PromQLGate != nil {
+		r.reportProgress(w, "gated", nil, start)
+		if err := r.checkGate(ctx, w); err != nil {
+			r.log.Error("PromQL gate not satisfied, not restarting", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if r.opts.Canary && canaryApplies(w) {
+		r.reportProgress(w, "canary", nil, start)
+		if err := r.restartCanary(ctx, w); err != nil {
+			r.log.Error("Canary failed, not restarting the rest", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if r.opts.CheckImages || r.opts.Backup != "" || r.opts.Canary {
+		r.reportProgress(w, "restarting", nil, start)
+	}
+
+	if r.opts.PreHook != nil {
+		if err := r.runPreHook(ctx, w); err != nil {
+			r.log.Error("Pre-hook failed, not restarting", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+
+	var err error
+	audit := r.auditAnnotations(ctx, w)
+	custom, isCustom := r.customOwner(w.Kind)
+	patchCtx, span := tracer.Start(ctx, "patch", workloadAttributes(w))
+	switch {
+	case w.Action == "operator-restart":
+		err = operatorClusters[w.Kind].restart(patchCtx, r, w, audit)
+	case w.Action == "delete-pods", w.Action == "evict":
+		err = r.replaceMatchedPods(patchCtx, w)
+	case w.Action == "scale-bounce":
+		err = r.scaleBounce(patchCtx, w, audit)
+	case isCustom:
+		err = r.restartCustomOwner(patchCtx, w, custom, audit)
+	case w.propagated:
+		err = r.restartPropagated(patchCtx, w, audit)
+	case w.argoCDApp != nil && !w.paused:
+		err = r.opts.ArgoCD.restart(patchCtx, *w.argoCDApp, w)
+	case w.Kind == "Deployment":
+		err = r.rolloutRestartDeployment(patchCtx, w.Namespace, w.Name, audit)
+		w.patched = err == nil
+		if err == nil && w.paused {
+			if err = r.setDeploymentPaused(patchCtx, w, false); err == nil {
+				// Pause it again however the rollout ends, even if the run is interrupted.
+				defer r.repauseDeployment(context.WithoutCancel(ctx), w)
+			}
+		}
+	case w.onDelete:
+		err = r.onDeleteRestartStatefulSet(patchCtx, w, audit)
+	case w.Action == "partitioned-restart":
+		err = r.partitionedRestartStatefulSet(patchCtx, w, audit)
+	case w.Kind == "StatefulSet" && (r.opts.Ordered || r.opts.RoleLabel != ""):
+		err = r.orderedRestartStatefulSet(patchCtx, w)
+	case w.Kind == "StatefulSet":
+		err = r.rolloutRestartStatefulSet(patchCtx, w.Namespace, w.Name, audit)
+	case w.Kind == "DaemonSet":
+		err = r.rolloutRestartDaemonSet(patchCtx, w.Namespace, w.Name, audit)
+	case w.Kind == "Job":
+		err = r.recreateJob(patchCtx, w.Namespace, w.Name, audit)
+	case w.Kind == "CronJob":
+		err = r.restartCronJob(patchCtx, w.Namespace, w.Name, audit)
+	case w.Kind == "Rollout":
+		err = r.restartArgoRollout(patchCtx, w.Namespace, w.Name, audit)
+	case w.Kind == "DeploymentConfig":
+		err = r.restartDeploymentConfig(patchCtx, w.Namespace, w.Name, audit)
+	}
+	endSpan(span, err)
+	w.patched = w.patched || err == nil
+	if err != nil {
+		r.log.Error("Restart failed", "workload", w.String(), "error", err)
+		w.fail(err, start)
+		return err
+	}
+	r.recordRestartEvent(ctx, w)
+	// Dependents may only start once their dependencies have rolled out.
+	wait := r.opts.Wait || w.hasDependents || w.paused
+	if wait && w.Kind == "CronJob" {
+		r.log.Info("Not waiting for cronjob, it has no rollout to wait for", "workload", w.String())
+	} else if wait && isCustom {
+		r.log.Info("Not waiting for custom owner, its operator performs the rollout", "workload", w.String())
+	} else if wait {
+		r.log.Info("Waiting for rollout", "workload", w.String(), "timeout", r.opts.Timeout)
+		observe := func(status *RolloutStatus) {
+			rollout = status
+			w.Rollout = status
+			r.reportProgress(w, "waiting", status, start)
+		}
+		var err error
+		ctx, span := tracer.Start(ctx, "wait", workloadAttributes(w))
+		if w.Action == "operator-restart" {
+			err = r.waitForClusterRestart(ctx, w, start, r.opts.Timeout, observe)
+		} else {
+			err = r.waitForRollout(ctx, w.Kind, w.Namespace, w.Name, r.opts.Timeout, observe)
+		}
+		endSpan(span, err)
+		if err != nil {
+			r.log.Error("Rollout failed", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if r.opts.HealthCheck != nil && w.Kind != "Job" && w.Kind != "CronJob" && !isCustom {
+		r.log.Info("Running health check", "workload", w.String())
+		r.reportProgress(w, "verifying", rollout, start)
+		if err := r.checkHealth(ctx, w); err != nil {
+			r.log.Error("Health check failed", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if r.opts.PostHook != nil && w.Kind != "Job" && w.Kind != "CronJob" && !isCustom {
+		r.log.Info("Running post-hook", "workload", w.String())
+		r.reportProgress(w, "verifying", rollout, start)
+		if err := r.runPostHook(ctx, w); err != nil {
+			r.log.Error("Post-hook failed", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			return err
+		}
+	}
+	if w.configHash != "" {
+		if err := r.recordConfigHash(ctx, w); err != nil {
+			r.log.Warn("Could not record config hash, the next run will restart the workload again", "workload", w.String(), "error", err)
+		}
+	}
+	w.Result = "succeeded"
+	w.Duration = time.Since(start).String()
+	return nil
+}
+
+// auditAnnotations record when, why, by whom and in which run a workload was
+// restarted, so the answer stays on the workload after the events expire.
+func (r *Restarter) auditAnnotations(ctx context.Context, w *Workload) map[string]string {
+	data := r.messageData(ctx, w)
+	reason := data.Reason
+	if r.opts.ReasonTemplate != nil {
+		reason = r.render(r.opts.ReasonTemplate, data, reason)
+	}
+	return map[string]string{
+		restartedAtAnnotation: time.Now().Format(time.RFC3339),
+		reasonAnnotation:      reason,
+		initiatorAnnotation:   data.Initiator,
+		runIDAnnotation:       r.opts.RunID,
+	}
+}
+
+// restartTemplate only sets annotations, so applying it leaves replicas, which
+// a HorizontalPodAutoscaler may be managing, and every other field to their
+// current managers.
+func restartTemplate(audit map[string]string) *corev1ac.PodTemplateSpecApplyConfiguration {
+	return corev1ac.PodTemplateSpec().WithAnnotations(audit)
+}
+
+func (r *Restarter) rolloutRestartDeployment(ctx context.Context, namespace, name string, audit map[string]string) error {
+	deployment := appsv1ac.Deployment(name, namespace).WithSpec(appsv1ac.DeploymentSpec().WithTemplate(restartTemplate(audit)))
+	_, err := r.clientset.AppsV1().Deployments(namespace).Apply(ctx, deployment, applyOptions)
+	return err
+}
+
+func (r *Restarter) setDeploymentPaused(ctx context.Context, w *Workload, paused bool) error {
+	patch := fmt.Sprintf(`{"spec":{"paused":%t}}`, paused)
+	_, err := r.clientset.AppsV1().Deployments(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{FieldManager: FieldManager})
+	return err
+}
+
+func (r *Restarter) repauseDeployment(ctx context.Context, w *Workload) {
+	r.log.Info("Pausing deployment again", "workload", w.String())
+	if err := r.setDeploymentPaused(ctx, w, true); err != nil {
+		r.log.Error("Could not pause deployment again, it is left resumed", "workload", w.String(), "error", err)
+	}
+}
+
+func (r *Restarter) rolloutRestartStatefulSet(ctx context.Context, namespace, name string, audit map[string]string) error {
+	statefulSet := appsv1ac.StatefulSet(name, namespace).WithSpec(appsv1ac.StatefulSetSpec().WithTemplate(restartTemplate(audit)))
+	_, err := r.clientset.AppsV1().StatefulSets(namespace).Apply(ctx, statefulSet, applyOptions)
+	return err
+}
+
+func (r *Restarter) rolloutRestartDaemonSet(ctx context.Context, namespace, name string, audit map[string]string) error {
+	daemonSet := appsv1ac.DaemonSet(name, namespace).WithSpec(appsv1ac.DaemonSetSpec().WithTemplate(restartTemplate(audit)))
+	_, err := r.clientset.AppsV1().DaemonSets(namespace).Apply(ctx, daemonSet, applyOptions)
+	return err
+}
@@ -0,0 +1,78 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFieldSelectors(t *testing.T) {
+	manyNodes := map[string]bool{}
+	for i := 0; i <= maxSplitLists; i++ {
+		manyNodes[fmt.Sprintf("node-%d", i)] = true
+	}
+	tests := []struct {
+		name          string
+		patterns      []string
+		fieldSelector string
+		nodes         map[string]bool
+		want          []string
+	}{
+		{name: "no patterns", want: []string{""}},
+		{name: "field selector only", fieldSelector: "status.phase=Running", want: []string{"status.phase=Running"}},
+		{name: "plain names", patterns: []string{"postgres-0", "redis-0"}, want: []string{"metadata.name=postgres-0", "metadata.name=redis-0"}},
+		{
+			name:          "plain names with field selector",
+			patterns:      []string{"postgres-0"},
+			fieldSelector: "status.phase=Running",
+			want:          []string{"status.phase=Running,metadata.name=postgres-0"},
+		},
+		{name: "glob", patterns: []string{"postgres-0", "*database*"}, want: []string{""}},
+		{name: "regex", patterns: []string{"re:^pg-0$"}, want: []string{""}},
+		{name: "nodes", patterns: []string{"*database*"}, nodes: map[string]bool{"node-b": true, "node-a": true}, want: []string{"spec.nodeName=node-a", "spec.nodeName=node-b"}},
+		{name: "names win over nodes", patterns: []string{"postgres-0"}, nodes: map[string]bool{"node-a": true}, want: []string{"metadata.name=postgres-0"}},
+		{name: "too many nodes", nodes: manyNodes, want: []string{""}},
+	}
+	for _, tt := range tests {
+		r := New(nil, nil, Options{FieldSelector: tt.fieldSelector})
+		for _, raw := range tt.patterns {
+			p, err := ParseNamePattern(raw)
+			if err != nil {
+				t.Fatalf("%s: ParseNamePattern(%q): %v", tt.name, raw, err)
+			}
+			r.opts.Patterns = append(r.opts.Patterns, p)
+		}
+		r.nodes = tt.nodes
+		if got := r.fieldSelectors(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: fieldSelectors = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRestartDeployment(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "api"}}
+	clientset := fake.NewSimpleClientset(deployment)
+	r := New(clientset, nil, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+
+	w := &Workload{Kind: "Deployment", Namespace: "prod", Name: "api", Action: "restart"}
+	if err := r.Restart(context.Background(), w); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	got, err := clientset.AppsV1().Deployments("prod").Get(context.Background(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Spec.Template.Annotations[restartedAtAnnotation]; !ok {
+		t.Errorf("pod template annotations = %v, want %s", got.Spec.Template.Annotations, restartedAtAnnotation)
+	}
+	if w.Result != "succeeded" {
+		t.Errorf("result = %q, want succeeded", w.Result)
+	}
+}
@@ -0,0 +1,121 @@
+package restarter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+// RetryPolicy retries API requests that failed for a reason likely to pass,
+// such as a timeout, a dropped connection, throttling (429) or a server
+// error (5xx), with exponential backoff and jitter. Requests refused for
+// good, such as with 403 or 404, are never retried.
+type RetryPolicy struct {
+	// Retries is how many times a request is retried after it first fails.
+	Retries int
+	// Backoff is the delay before the first retry; it doubles on every
+	// retry, up to MaxBackoff, unless the server asks for a longer one.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Budget, when set, bounds the retries of every request sent through
+	// the config, so an API server in trouble is not kept busy by them.
+	Budget int
+}
+
+// DefaultRetry is the RetryPolicy the command line uses unless told otherwise.
+var DefaultRetry = RetryPolicy{Retries: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second, Budget: 100}
+
+// WithRetry returns a copy of config whose requests are retried by policy.
+func WithRetry(config *rest.Config, policy RetryPolicy, log *slog.Logger) *rest.Config {
+	if policy.Retries < 1 {
+		return config
+	}
+	if log == nil {
+		log = slog.Default()
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetry.MaxBackoff
+	}
+	config = rest.CopyConfig(config)
+	budget := &atomic.Int64{}
+	budget.Store(int64(policy.Budget))
+	config.Wrap(func(next http.RoundTripper) http.RoundTripper {
+		return &retryTransport{next: next, policy: policy, budget: budget, log: log}
+	})
+	return config
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+	budget *atomic.Int64
+	log    *slog.Logger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.policy.Retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+		if t.policy.Budget > 0 && t.budget.Add(-1) < 0 {
+			t.log.Warn("Not retrying API request, the retry budget is spent", "method", req.Method, "url", req.URL.Path)
+			return resp, err
+		}
+
+		delay := time.Duration(float64(t.policy.Backoff) * math.Pow(2, float64(attempt)))
+		delay = wait.Jitter(min(delay, t.policy.MaxBackoff), 0.5)
+		cause := ""
+		if err != nil {
+			cause = err.Error()
+		} else {
+			cause = resp.Status
+			if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && time.Duration(seconds)*time.Second > delay {
+				delay = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		t.log.Debug("Retrying API request", "method", req.Method, "url", req.URL.Path, "attempt", attempt+1, "cause", cause, "delay", delay)
+		if !sleep(req.Context(), delay) {
+			return nil, req.Context().Err()
+		}
+
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether a request may be sent again. A POST that may
+// have reached the server, such as a Job being created, is only retried
+// when the server says it did not act on it.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && req.Method != http.MethodPost
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return req.Method != http.MethodPost
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package restarter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	errReset := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name   string
+		method string
+		ctx    context.Context
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "get connection error", method: http.MethodGet, err: errReset, want: true},
+		{name: "post connection error", method: http.MethodPost, err: errReset, want: false},
+		{name: "cancelled request", method: http.MethodGet, ctx: cancelled, err: errReset, want: false},
+		{name: "deadline exceeded", method: http.MethodGet, err: context.DeadlineExceeded, want: false},
+		{name: "get too many requests", method: http.MethodGet, status: http.StatusTooManyRequests, want: true},
+		{name: "post too many requests", method: http.MethodPost, status: http.StatusTooManyRequests, want: true},
+		{name: "post service unavailable", method: http.MethodPost, status: http.StatusServiceUnavailable, want: true},
+		{name: "get internal server error", method: http.MethodGet, status: http.StatusInternalServerError, want: true},
+		{name: "post internal server error", method: http.MethodPost, status: http.StatusInternalServerError, want: false},
+		{name: "patch gateway timeout", method: http.MethodPatch, status: http.StatusGatewayTimeout, want: true},
+		{name: "conflict", method: http.MethodPatch, status: http.StatusConflict, want: false},
+		{name: "ok", method: http.MethodGet, status: http.StatusOK, want: false},
+	}
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		req, err := http.NewRequestWithContext(ctx, tt.method, "https://kubernetes.default/api", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp *http.Response
+		if tt.err == nil {
+			resp = &http.Response{StatusCode: tt.status}
+		}
+		if got := retryable(req, resp, tt.err); got != tt.want {
+			t.Errorf("%s: retryable = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
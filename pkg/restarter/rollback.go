@@ -0,0 +1,142 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// Rollback reverts each restarted Deployment in plan to its previous
+// revision and returns the workloads that failed. Other kinds are skipped.
+func (r *Restarter) Rollback(ctx context.Context, plan []*Workload, includeHealthy bool) []*Workload {
+	var failed []*Workload
+	for _, w := range plan {
+		w.Action = "rollback"
+		if w.Kind != "Deployment" {
+			r.log.Info("Skipping rollback, only deployments can be rolled back", "workload", w.String())
+			w.Result = "skipped"
+			continue
+		}
+
+		start := time.Now()
+		rolledBack, err := r.rollbackDeployment(ctx, w.Namespace, w.Name, includeHealthy)
+		if err != nil {
+			r.log.Error("Rollback failed", "workload", w.String(), "error", err)
+			w.fail(err, start)
+			failed = append(failed, w)
+			continue
+		}
+		w.Duration = time.Since(start).String()
+		if !rolledBack {
+			w.Result = "skipped"
+			continue
+		}
+		w.Result = "succeeded"
+	}
+	return failed
+}
+
+func (r *Restarter) rollbackDeployment(ctx context.Context, namespace, name string, includeHealthy bool) (bool, error) {
+	deploymentsClient := r.clientset.AppsV1().Deployments(namespace)
+	rolledBack := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := deploymentsClient.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if _, ok := deployment.Spec.Template.Annotations[restartedAtAnnotation]; !ok {
+			r.log.Info("Skipping rollback, deployment has not been restarted", "deployment", namespace+"/"+name)
+			return nil
+		}
+		if !includeHealthy {
+			status, err := deploymentStatus(deployment)
+			if err == nil && status.Complete {
+				r.log.Info("Skipping rollback, rollout is healthy", "deployment", namespace+"/"+name)
+				return nil
+			}
+		}
+
+		previous, err := r.previousReplicaSet(ctx, deployment)
+		if err != nil {
+			return err
+		}
+
+		template := previous.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		deployment.Spec.Template = *template
+
+		r.log.Info("Rolling back deployment", "deployment", namespace+"/"+name, "revision", previous.Annotations[revisionAnnotation])
+		if _, err := deploymentsClient.Update(ctx, deployment, metav1.UpdateOptions{FieldManager: FieldManager}); err != nil {
+			return err
+		}
+		rolledBack = true
+		return nil
+	})
+	return rolledBack, err
+}
+
+func (r *Restarter) previousReplicaSet(ctx context.Context, deployment *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	current, err := strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("deployment %s/%s has no valid revision annotation", deployment.Namespace, deployment.Name)
+	}
+
+	replicaSets, err := r.clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *appsv1.ReplicaSet
+	var previousRevision int64
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if owner := metav1.GetControllerOf(rs); owner == nil || owner.UID != deployment.UID {
+			continue
+		}
+		revision, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil || revision >= current {
+			continue
+		}
+		if previous == nil || revision > previousRevision {
+			previous, previousRevision = rs, revision
+		}
+	}
+	if previous == nil {
+		return nil, fmt.Errorf("no previous revision found for deployment %s/%s", deployment.Namespace, deployment.Name)
+	}
+	return previous, nil
+}
+
+// rollbackRestarted rolls back the Deployments of plan that this run
+// patched, whether or not their rollout then succeeded, after OnError stopped
+// the run. Their result stays that of the restart, noting the rollback.
+func (r *Restarter) rollbackRestarted(ctx context.Context, plan []*Workload) {
+	ctx = context.WithoutCancel(ctx)
+	for _, w := range plan {
+		if !w.patched {
+			continue
+		}
+		if w.Kind != "Deployment" || w.Action != "restart" {
+			r.log.Warn("Not rolling back workload, only restarted deployments can be rolled back", "workload", w.String())
+			continue
+		}
+		rolledBack, err := r.rollbackDeployment(ctx, w.Namespace, w.Name, true)
+		switch {
+		case err != nil:
+			r.log.Error("Rollback failed", "workload", w.String(), "error", err)
+			w.Error = strings.TrimPrefix(w.Error+"; ", "; ") + "rollback failed: " + err.Error()
+		case rolledBack && w.Result == "succeeded":
+			w.Result = "rolled back"
+		case rolledBack:
+			w.Error += "; rolled back"
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const rolloutPollInterval = 2 * time.Second
+
+// WaitForRollout polls until the workload has finished rolling out or timeout elapses.
+func (r *Restarter) WaitForRollout(ctx context.Context, kind, namespace, name string, timeout time.Duration) error {
+	return r.waitForRollout(ctx, kind, namespace, name, timeout, nil)
+}
+
+// waitForRollout is WaitForRollout that also passes every status it polls to
+// observe, when set.
+func (r *Restarter) waitForRollout(ctx context.Context, kind, namespace, name string, timeout time.Duration, observe func(*RolloutStatus)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, true, func(ctx context.Context) (bool, error) {
+		status, err := r.RolloutStatus(ctx, kind, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		if observe != nil {
+			observe(status)
+		}
+		return status.Complete, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for %s %s/%s to roll out", timeout, kind, namespace, name)
+	}
+	return err
+}
+
+// RolloutStatus summarises how far a workload has rolled out.
+type RolloutStatus struct {
+	Desired  int32 `json:"desired"`
+	Updated  int32 `json:"updated"`
+	Ready    int32 `json:"ready"`
+	Complete bool  `json:"complete"`
+}
+
+// RolloutStatus reports the current rollout progress of a workload.
+func (r *Restarter) RolloutStatus(ctx context.Context, kind, namespace, name string) (*RolloutStatus, error) {
+	if _, ok := operatorClusters[kind]; ok {
+		return r.operatorClusterStatus(ctx, kind, namespace, name)
+	}
+
+	switch kind {
+	case "Deployment":
+		deployment, err := r.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return deploymentStatus(deployment)
+	case "StatefulSet":
+		statefulSet, err := r.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return statefulSetStatus(statefulSet), nil
+	case "DaemonSet":
+		daemonSet, err := r.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return daemonSetStatus(daemonSet), nil
+	case "Job":
+		job, err := r.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return jobStatus(job), nil
+	case "Rollout":
+		rollout, err := r.dynamic.Resource(argoRolloutsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return argoRolloutStatus(rollout), nil
+	case "DeploymentConfig":
+		deploymentConfig, err := r.dynamic.Resource(deploymentConfigsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return deploymentConfigStatus(deploymentConfig)
+	default:
+		return nil, fmt.Errorf("cannot report rollout status for unsupported kind %s", kind)
+	}
+}
+
+func deploymentStatus(deployment *appsv1.Deployment) (*RolloutStatus, error) {
+	status := deployment.Status
+	s := &RolloutStatus{Desired: 1, Updated: status.UpdatedReplicas, Ready: status.ReadyReplicas}
+	if deployment.Spec.Replicas != nil {
+		s.Desired = *deployment.Spec.Replicas
+	}
+
+	for _, c := range status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return s, fmt.Errorf("deployment %s/%s exceeded its progress deadline", deployment.Namespace, deployment.Name)
+		}
+	}
+
+	s.Complete = deployment.Generation <= status.ObservedGeneration &&
+		status.UpdatedReplicas >= s.Desired &&
+		status.Replicas <= status.UpdatedReplicas &&
+		status.AvailableReplicas >= status.UpdatedReplicas
+	return s, nil
+}
+
+func statefulSetStatus(statefulSet *appsv1.StatefulSet) *RolloutStatus {
+	status := statefulSet.Status
+	s := &RolloutStatus{Desired: 1, Updated: status.UpdatedReplicas, Ready: status.ReadyReplicas}
+	if statefulSet.Spec.Replicas != nil {
+		s.Desired = *statefulSet.Spec.Replicas
+	}
+
+	s.Complete = status.ObservedGeneration != 0 &&
+		statefulSet.Generation <= status.ObservedGeneration &&
+		status.ReadyReplicas >= s.Desired
+	if s.Complete && statefulSet.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType {
+		// Pods below a partition stay on the current revision, so a
+		// partitioned rollout is complete once the pods above it are updated.
+		if rolling := statefulSet.Spec.UpdateStrategy.RollingUpdate; rolling != nil && rolling.Partition != nil && *rolling.Partition > 0 {
+			s.Complete = status.UpdatedReplicas >= s.Desired-*rolling.Partition
+		} else {
+			s.Complete = status.UpdatedReplicas >= s.Desired && status.UpdateRevision == status.CurrentRevision
+		}
+	}
+	return s
+}
+
+func daemonSetStatus(daemonSet *appsv1.DaemonSet) *RolloutStatus {
+	status := daemonSet.Status
+	return &RolloutStatus{
+		Desired: status.DesiredNumberScheduled,
+		Updated: status.UpdatedNumberScheduled,
+		Ready:   status.NumberReady,
+		Complete: daemonSet.Generation <= status.ObservedGeneration &&
+			status.UpdatedNumberScheduled >= status.DesiredNumberScheduled &&
+			status.NumberAvailable >= status.DesiredNumberScheduled,
+	}
+}
@@ -0,0 +1,76 @@
+package restarter
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestStatefulSetStatus(t *testing.T) {
+	three, one := int32(3), int32(1)
+	rollingUpdate := func(partition *int32) appsv1.StatefulSetUpdateStrategy {
+		return appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: partition},
+		}
+	}
+	tests := []struct {
+		name     string
+		strategy appsv1.StatefulSetUpdateStrategy
+		status   appsv1.StatefulSetStatus
+		want     bool
+	}{
+		{
+			name:     "rolled out",
+			strategy: rollingUpdate(nil),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 3, CurrentRevision: "b", UpdateRevision: "b"},
+			want:     true,
+		},
+		{
+			name:     "generation not observed",
+			strategy: rollingUpdate(nil),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 1, ReadyReplicas: 3, UpdatedReplicas: 3, CurrentRevision: "b", UpdateRevision: "b"},
+		},
+		{
+			name:     "pods not ready",
+			strategy: rollingUpdate(nil),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, UpdatedReplicas: 3, CurrentRevision: "b", UpdateRevision: "b"},
+		},
+		{
+			name:     "revision not current",
+			strategy: rollingUpdate(nil),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 3, CurrentRevision: "a", UpdateRevision: "b"},
+		},
+		{
+			name:     "updated above partition",
+			strategy: rollingUpdate(&one),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 2, CurrentRevision: "a", UpdateRevision: "b"},
+			want:     true,
+		},
+		{
+			name:     "not yet updated above partition",
+			strategy: rollingUpdate(&one),
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "a", UpdateRevision: "b"},
+		},
+		{
+			name:     "on delete only needs ready pods",
+			strategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+			status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 3, UpdatedReplicas: 0, CurrentRevision: "a", UpdateRevision: "b"},
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		statefulSet := &appsv1.StatefulSet{
+			Spec:   appsv1.StatefulSetSpec{Replicas: &three, UpdateStrategy: tt.strategy},
+			Status: tt.status,
+		}
+		statefulSet.Generation = 2
+		s := statefulSetStatus(statefulSet)
+		if s.Complete != tt.want {
+			t.Errorf("%s: Complete = %t, want %t", tt.name, s.Complete, tt.want)
+		}
+		if s.Desired != 3 || s.Ready != tt.status.ReadyReplicas || s.Updated != tt.status.UpdatedReplicas {
+			t.Errorf("%s: status = %+v, want 3 desired, %d ready, %d updated", tt.name, s, tt.status.ReadyReplicas, tt.status.UpdatedReplicas)
+		}
+	}
+}
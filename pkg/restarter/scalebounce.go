@@ -0,0 +1,134 @@
+package restarter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// scaledFromAnnotation records the replicas of a workload while the
+// scale-bounce strategy has it scaled to zero, so a run that dies before
+// scaling it back leaves them on the workload.
+const scaledFromAnnotation = "restart-tool/scaled-from"
+
+func scaleBounceApplies(kind string) bool {
+	return kind == "Deployment" || kind == "StatefulSet"
+}
+
+// scaleBounce scales w to zero, waits for all of its pods to terminate and
+// scales it back to the replicas it had, for databases that cannot run an
+// old and a new pod side by side.
+func (r *Restarter) scaleBounce(ctx context.Context, w *Workload, audit map[string]string) error {
+	obj, err := r.getWorkloadMeta(ctx, w)
+	if err != nil {
+		return err
+	}
+	var replicas *int32
+	var selector *metav1.LabelSelector
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		replicas, selector = obj.Spec.Replicas, obj.Spec.Selector
+	case *appsv1.StatefulSet:
+		replicas, selector = obj.Spec.Replicas, obj.Spec.Selector
+	default:
+		return fmt.Errorf("%s cannot be scaled", w)
+	}
+	n := int32(1)
+	if replicas != nil {
+		n = *replicas
+	}
+	if recorded, ok := obj.GetAnnotations()[scaledFromAnnotation]; ok {
+		if parsed, err := strconv.ParseInt(recorded, 10, 32); err == nil {
+			n = int32(parsed)
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("%s is scaled to zero, there is nothing to restart", w)
+	}
+
+	annotations := map[string]string{scaledFromAnnotation: strconv.Itoa(int(n))}
+	for k, v := range audit {
+		annotations[k] = v
+	}
+	if err := r.annotateWorkload(ctx, w, annotations); err != nil {
+		return fmt.Errorf("recording the replicas of %s: %w", w, err)
+	}
+	r.log.Info("Scaling workload to zero", "workload", w.String(), "replicas", n)
+	if err := r.scaleWorkload(ctx, w.Kind, w.Namespace, w.Name, 0); err != nil {
+		return err
+	}
+
+	podSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return err
+	}
+	err = wait.PollUntilContextTimeout(ctx, rolloutPollInterval, r.opts.Timeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := r.clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: podSelector.String()})
+		if err != nil {
+			return false, err
+		}
+		return len(pods.Items) == 0, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for the pods of %s to terminate, it is left scaled to zero with its replicas in the %s annotation", r.opts.Timeout, w, scaledFromAnnotation)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.log.Info("Scaling workload back up", "workload", w.String(), "replicas", n)
+	if err := r.scaleWorkload(ctx, w.Kind, w.Namespace, w.Name, n); err != nil {
+		return fmt.Errorf("scaling %s back to %d replicas: %w", w, n, err)
+	}
+	return r.annotateWorkload(ctx, w, map[string]string{scaledFromAnnotation: ""})
+}
+
+// annotateWorkload sets annotations on w, removing those with an empty value.
+func (r *Restarter) annotateWorkload(ctx context.Context, w *Workload, annotations map[string]string) error {
+	values := map[string]any{}
+	for k, v := range annotations {
+		values[k] = v
+		if v == "" {
+			values[k] = nil
+		}
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": values}})
+	if err != nil {
+		return err
+	}
+	options := metav1.PatchOptions{FieldManager: FieldManager}
+	switch w.Kind {
+	case "Deployment":
+		_, err = r.clientset.AppsV1().Deployments(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, options)
+	case "StatefulSet":
+		_, err = r.clientset.AppsV1().StatefulSets(w.Namespace).Patch(ctx, w.Name, types.MergePatchType, patch, options)
+	default:
+		err = fmt.Errorf("unsupported kind %s", w.Kind)
+	}
+	return err
+}
+
+func (r *Restarter) scaleWorkload(ctx context.Context, kind, namespace, name string, replicas int32) error {
+	scale := &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+	}
+	options := metav1.UpdateOptions{FieldManager: FieldManager}
+	var err error
+	switch kind {
+	case "Deployment":
+		_, err = r.clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, options)
+	case "StatefulSet":
+		_, err = r.clientset.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, options)
+	default:
+		err = fmt.Errorf("unsupported kind %s", kind)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+type secretWatcher struct {
+	r      *Restarter
+	name   string
+	settle time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+
+	// restartMu keeps rotations in different namespaces from restarting
+	// their consumers at the same time, so BatchSize and Stagger still hold.
+	restartMu sync.Mutex
+}
+
+// WatchSecret restarts the matching workloads whose pods use the Secret name,
+// as a volume or through env or envFrom, whenever its data changes, until ctx
+// is cancelled. Consumers are restarted settle after the last change, so a
+// rotation that updates the Secret several times restarts them once.
+func (r *Restarter) WatchSecret(ctx context.Context, namespaces []string, name string, settle time.Duration) error {
+	sw := &secretWatcher{r: r, name: name, settle: settle, pending: map[string]*time.Timer{}}
+	defer sw.stop()
+
+	for _, namespace := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(r.clientset, 0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+				lo.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			}),
+		)
+		_, err := factory.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, obj any) {
+				oldSecret, secret := old.(*corev1.Secret), obj.(*corev1.Secret)
+				if !reflect.DeepEqual(oldSecret.Data, secret.Data) {
+					sw.changed(ctx, secret)
+				}
+			},
+		})
+		if err != nil {
+			return err
+		}
+		factory.Start(ctx.Done())
+		for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("failed to sync %v informer", typ)
+			}
+		}
+	}
+
+	r.log.Info("Watching secret for rotation", "secret", name, "namespaces", strings.Join(namespaces, ","), "settle", settle)
+	<-ctx.Done()
+	r.log.Info("Stopping secret watch")
+	return nil
+}
+
+func (sw *secretWatcher) changed(ctx context.Context, secret *corev1.Secret) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.r.log.Info("Secret changed, waiting for it to settle", "secret", secret.Namespace+"/"+secret.Name, "settle", sw.settle)
+	if timer, ok := sw.pending[secret.Namespace]; ok {
+		timer.Reset(sw.settle)
+		return
+	}
+	namespace := secret.Namespace
+	sw.pending[namespace] = time.AfterFunc(sw.settle, func() {
+		sw.mu.Lock()
+		delete(sw.pending, namespace)
+		sw.mu.Unlock()
+		sw.restartConsumers(ctx, namespace)
+	})
+}
+
+func (sw *secretWatcher) stop() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	for _, timer := range sw.pending {
+		timer.Stop()
+	}
+}
+
+func (sw *secretWatcher) restartConsumers(ctx context.Context, namespace string) {
+	sw.restartMu.Lock()
+	defer sw.restartMu.Unlock()
+	r := sw.r
+	if ctx.Err() != nil {
+		return
+	}
+
+	pods, err := r.ListPods(ctx, []string{namespace})
+	if err != nil {
+		r.log.Error("Listing pods failed", "namespace", namespace, "error", err)
+		return
+	}
+	consumers := &corev1.PodList{}
+	for _, pod := range pods.Items {
+		if podUsesSecret(&pod, sw.name) {
+			consumers.Items = append(consumers.Items, pod)
+		}
+	}
+
+	plan, _ := r.Plan(ctx, consumers)
+	if len(plan) == 0 {
+		r.log.Info("No workloads to restart for rotated secret", "secret", namespace+"/"+sw.name)
+		return
+	}
+	for _, w := range plan {
+		w.Reason = "secret " + sw.name + " was rotated"
+	}
+	if r.opts.DryRun {
+		for _, w := range plan {
+			r.log.Info("Dry run, not restarting", "workload", w.String())
+		}
+		return
+	}
+	r.log.Info("Restarting consumers of rotated secret", "secret", namespace+"/"+sw.name, "workloads", len(plan))
+	r.RestartAll(ctx, plan)
+}
+
+// podUsesSecret reports whether pod mounts name or reads it into the
+// environment of any of its containers.
+func podUsesSecret(pod *corev1.Pod, name string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == name {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.SecretRef != nil && from.SecretRef.Name == name {
+				return true
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func (r *Restarter) orderedRestartStatefulSet(ctx context.Context, w *Workload) error {
+	namespace, name := w.Namespace, w.Name
+	statefulSet, err := r.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+
+	var pods []*corev1.Pod
+	for ordinal := replicas - 1; ordinal >= 0; ordinal-- {
+		podName := fmt.Sprintf("%s-%d", name, ordinal)
+		pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			r.log.Info("Pod does not exist, skipping", "pod", namespace+"/"+podName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pods = append(pods, pod)
+	}
+	if r.opts.RoleLabel != "" {
+		sort.SliceStable(pods, func(i, j int) bool {
+			return !r.isPrimary(pods[i]) && r.isPrimary(pods[j])
+		})
+	}
+
+	for _, pod := range pods {
+		if r.isPrimary(pod) {
+			if r.opts.SwitchoverHook != nil {
+				r.log.Info("Running switchover hook", "pod", namespace+"/"+pod.Name)
+				if err := r.runHook(ctx, w, "switchover-hook", r.opts.SwitchoverHook, pod); err != nil {
+					return fmt.Errorf("switchover hook in pod %s: %w", pod.Name, err)
+				}
+			}
+			r.log.Info("Deleting primary pod", "pod", namespace+"/"+pod.Name, "role", pod.Labels[r.opts.RoleLabel])
+		} else {
+			r.log.Info("Deleting pod", "pod", namespace+"/"+pod.Name, "role", pod.Labels[r.opts.RoleLabel])
+		}
+		err := r.clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, r.podDeleteOptions(pod))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		if err := r.waitForPodReplaced(ctx, namespace, pod.Name, pod.UID, r.opts.Timeout+r.opts.DrainPeriod); err != nil {
+			return err
+		}
+		r.log.Info("Replacement pod is ready", "pod", namespace+"/"+pod.Name)
+		if err := r.waitForCaughtUp(ctx, namespace, pod.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// onDeleteRestartStatefulSet restarts a StatefulSet whose OnDelete update
+// strategy ignores template changes: it applies the restart annotations,
+// so the recreated pods carry them, then deletes the pods one at a time
+// from the highest ordinal, waiting for each to be recreated and ready.
+func (r *Restarter) onDeleteRestartStatefulSet(ctx context.Context, w *Workload, audit map[string]string) error {
+	if err := r.rolloutRestartStatefulSet(ctx, w.Namespace, w.Name, audit); err != nil {
+		return err
+	}
+	return r.orderedRestartStatefulSet(ctx, w)
+}
+
+// isPrimary reports whether pod's RoleLabel marks it as a primary.
+func (r *Restarter) isPrimary(pod *corev1.Pod) bool {
+	if r.opts.RoleLabel == "" {
+		return false
+	}
+	role, ok := pod.Labels[r.opts.RoleLabel]
+	return ok && slices.Contains(r.opts.PrimaryRoles, role)
+}
+
+func (r *Restarter) waitForPodReplaced(ctx context.Context, namespace, name string, oldUID types.UID, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, rolloutPollInterval, false, func(ctx context.Context) (bool, error) {
+		pod, err := r.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return pod.UID != oldUID && podReady(pod), nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out after %s waiting for pod %s/%s to be replaced", timeout, namespace, name)
+	}
+	return err
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
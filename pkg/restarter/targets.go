@@ -0,0 +1,123 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workloadKinds maps kubectl's names for the restartable kinds to the kinds.
+var workloadKinds = map[string]string{
+	"deployment":        "Deployment",
+	"deployments":       "Deployment",
+	"deploy":            "Deployment",
+	"statefulset":       "StatefulSet",
+	"statefulsets":      "StatefulSet",
+	"sts":               "StatefulSet",
+	"daemonset":         "DaemonSet",
+	"daemonsets":        "DaemonSet",
+	"ds":                "DaemonSet",
+	"job":               "Job",
+	"jobs":              "Job",
+	"cronjob":           "CronJob",
+	"cronjobs":          "CronJob",
+	"cj":                "CronJob",
+	"rollout":           "Rollout",
+	"rollouts":          "Rollout",
+	"ro":                "Rollout",
+	"deploymentconfig":  "DeploymentConfig",
+	"deploymentconfigs": "DeploymentConfig",
+	"dc":                "DeploymentConfig",
+}
+
+// WorkloadRef names a workload to restart directly, without discovering it
+// through its pods.
+type WorkloadRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// ParseWorkloadRef parses KIND/NAME, where KIND is a restartable kind, a
+// database operator's cluster kind or one of kubectl's names for them, such
+// as deploy or sts. The namespace is left for the caller to set.
+func ParseWorkloadRef(raw string) (WorkloadRef, error) {
+	kind, name, ok := strings.Cut(raw, "/")
+	if !ok || kind == "" || name == "" || strings.Contains(name, "/") {
+		return WorkloadRef{}, fmt.Errorf("invalid workload %q: must be KIND/NAME", raw)
+	}
+	if k, ok := workloadKinds[strings.ToLower(kind)]; ok {
+		return WorkloadRef{Kind: k, Name: name}, nil
+	}
+	for k := range operatorClusters {
+		if strings.EqualFold(kind, k) {
+			return WorkloadRef{Kind: k, Name: name}, nil
+		}
+	}
+	return WorkloadRef{}, fmt.Errorf("invalid workload %q: unsupported kind %s", raw, kind)
+}
+
+func kindAPIVersion(kind string) string {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet":
+		return appsv1.SchemeGroupVersion.String()
+	case "Job", "CronJob":
+		return batchv1.SchemeGroupVersion.String()
+	case "Rollout":
+		return argoRolloutsResource.GroupVersion().String()
+	case "DeploymentConfig":
+		return deploymentConfigsResource.GroupVersion().String()
+	}
+	return operatorClusters[kind].resource.GroupVersion().String()
+}
+
+// PlanWorkloads plans the restart of the named workloads, which must exist,
+// with the same checks as Plan but without listing pods, so workloads
+// scaled to zero can be restarted too. Their pods are listed through each
+// workload's selector, for the features that act on them.
+func (r *Restarter) PlanWorkloads(ctx context.Context, refs []WorkloadRef) ([]*Workload, []SkippedPod, error) {
+	ctx, span := tracer.Start(ctx, "resolve workloads", trace.WithAttributes(attribute.Int("restart.targets", len(refs))))
+	defer span.End()
+
+	var plan []*Workload
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		w := r.newWorkload(ref.Kind, ref.Namespace, ref.Name, "named on the command line")
+		if seen[w.key()] {
+			continue
+		}
+		seen[w.key()] = true
+
+		obj, err := r.getWorkloadMeta(ctx, w)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", w, err)
+		}
+		w.apiVersion, w.uid = kindAPIVersion(w.Kind), obj.GetUID()
+		if w.Kind != "Job" && w.Kind != "CronJob" {
+			selector, err := r.workloadSelector(ctx, w)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", w, err)
+			}
+			pods, err := r.clientset.CoreV1().Pods(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return nil, nil, fmt.Errorf("listing pods of %s: %w", w, err)
+			}
+			for _, pod := range pods.Items {
+				w.Pods = append(w.Pods, pod.Name)
+				if w.podLabels == nil {
+					w.podLabels = pod.Labels
+				}
+			}
+		}
+		plan = append(plan, w)
+	}
+
+	workloads, skipped := r.checkPlan(ctx, plan, nil)
+	return workloads, skipped, nil
+}
@@ -0,0 +1,30 @@
+package restarter
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records spans through the global tracer provider, which does
+// nothing unless the program using this package installs one.
+var tracer = otel.Tracer("my-k8s-redeploy/pkg/restarter")
+
+func workloadAttributes(w *Workload) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("k8s.workload.kind", w.Kind),
+		attribute.String("k8s.namespace.name", w.Namespace),
+		attribute.String("k8s.workload.name", w.Name),
+		attribute.String("restart.action", w.Action),
+	)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
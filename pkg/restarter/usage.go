@@ -0,0 +1,140 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var podMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// UsageThreshold is a resource usage a container must exceed: a percentage
+// of its limit, or of its request when it has no limit, or an absolute
+// quantity.
+type UsageThreshold struct {
+	Percent  float64
+	Quantity *resource.Quantity
+}
+
+// ParseUsageThreshold parses a percentage such as 90% or a quantity such
+// as 2Gi or 500m.
+func ParseUsageThreshold(raw string) (UsageThreshold, error) {
+	if percent, ok := strings.CutSuffix(raw, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 {
+			return UsageThreshold{}, fmt.Errorf("invalid threshold %q: must be a positive percentage or a quantity", raw)
+		}
+		return UsageThreshold{Percent: p}, nil
+	}
+	quantity, err := resource.ParseQuantity(raw)
+	if err != nil || quantity.Sign() <= 0 {
+		return UsageThreshold{}, fmt.Errorf("invalid threshold %q: must be a positive percentage or a quantity", raw)
+	}
+	return UsageThreshold{Quantity: &quantity}, nil
+}
+
+func (t UsageThreshold) set() bool {
+	return t.Percent > 0 || t.Quantity != nil
+}
+
+// exceeded reports whether usage is above the threshold for a container
+// with resources, and how far.
+func (t UsageThreshold) exceeded(usage resource.Quantity, name corev1.ResourceName, resources corev1.ResourceRequirements) (string, bool) {
+	if t.Quantity != nil {
+		return usage.String(), usage.Cmp(*t.Quantity) > 0
+	}
+	bound, ok := resources.Limits[name]
+	of := "limit"
+	if !ok {
+		bound, ok = resources.Requests[name]
+		of = "request"
+	}
+	if !ok || bound.IsZero() {
+		return "", false
+	}
+	percent := float64(usage.MilliValue()) / float64(bound.MilliValue()) * 100
+	return fmt.Sprintf("%.0f%% of its %s %s", percent, of, bound.String()), percent > t.Percent
+}
+
+// selectUsage fetches the current resource usage of the containers of the
+// pods in namespaces from the metrics API, keyed by namespace/pod and
+// container. It leaves r.usage nil when no usage threshold is set.
+func (r *Restarter) selectUsage(ctx context.Context, namespaces []string) error {
+	if !r.opts.MemoryAbove.set() && !r.opts.CPUAbove.set() {
+		return nil
+	}
+
+	usage := map[string]map[string]corev1.ResourceList{}
+	for _, namespace := range namespaces {
+		list, err := r.dynamic.Resource(podMetricsResource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: r.labelSelector()})
+		if err != nil {
+			return fmt.Errorf("listing pod metrics: %w", err)
+		}
+		for _, item := range list.Items {
+			containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+			byContainer := map[string]corev1.ResourceList{}
+			for _, c := range containers {
+				container, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(container, "name")
+				raw, _, _ := unstructured.NestedStringMap(container, "usage")
+				resources := corev1.ResourceList{}
+				for k, v := range raw {
+					if quantity, err := resource.ParseQuantity(v); err == nil {
+						resources[corev1.ResourceName(k)] = quantity
+					}
+				}
+				byContainer[name] = resources
+			}
+			usage[item.GetNamespace()+"/"+item.GetName()] = byContainer
+		}
+	}
+	r.usage = usage
+	return nil
+}
+
+// matchUsage reports whether a container of pod uses more memory than
+// MemoryAbove, and one uses more CPU than CPUAbove, whichever are set.
+func (r *Restarter) matchUsage(pod *corev1.Pod) ([]string, bool) {
+	containers, ok := r.usage[pod.Namespace+"/"+pod.Name]
+	if !ok {
+		return nil, false
+	}
+	var reasons []string
+	for _, threshold := range []struct {
+		name      corev1.ResourceName
+		threshold UsageThreshold
+	}{
+		{corev1.ResourceMemory, r.opts.MemoryAbove},
+		{corev1.ResourceCPU, r.opts.CPUAbove},
+	} {
+		if !threshold.threshold.set() {
+			continue
+		}
+		matched := false
+		for _, c := range pod.Spec.Containers {
+			usage, ok := containers[c.Name][threshold.name]
+			if !ok {
+				continue
+			}
+			if how, ok := threshold.threshold.exceeded(usage, threshold.name, c.Resources); ok {
+				reasons = append(reasons, fmt.Sprintf("container %s uses %s %s", c.Name, threshold.name, how))
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, false
+		}
+	}
+	return reasons, true
+}
@@ -0,0 +1,75 @@
+package restarter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseUsageThreshold(t *testing.T) {
+	tests := []struct {
+		raw      string
+		percent  float64
+		quantity string
+		wantErr  bool
+	}{
+		{raw: "90%", percent: 90},
+		{raw: "12.5%", percent: 12.5},
+		{raw: "3Gi", quantity: "3Gi"},
+		{raw: "1500m", quantity: "1500m"},
+		{raw: "0%", wantErr: true},
+		{raw: "-5%", wantErr: true},
+		{raw: "many%", wantErr: true},
+		{raw: "0", wantErr: true},
+		{raw: "-1Gi", wantErr: true},
+		{raw: "lots", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUsageThreshold(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUsageThreshold(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.Percent != tt.percent {
+			t.Errorf("ParseUsageThreshold(%q).Percent = %v, want %v", tt.raw, got.Percent, tt.percent)
+		}
+		switch {
+		case tt.quantity == "" && got.Quantity != nil:
+			t.Errorf("ParseUsageThreshold(%q).Quantity = %s, want none", tt.raw, got.Quantity)
+		case tt.quantity != "" && (got.Quantity == nil || got.Quantity.Cmp(resource.MustParse(tt.quantity)) != 0):
+			t.Errorf("ParseUsageThreshold(%q).Quantity = %v, want %s", tt.raw, got.Quantity, tt.quantity)
+		}
+	}
+}
+
+func TestUsageThresholdExceeded(t *testing.T) {
+	limited := corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}}
+	requested := corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}}
+	tests := []struct {
+		threshold string
+		usage     string
+		resources corev1.ResourceRequirements
+		want      bool
+	}{
+		{"90%", "950Mi", limited, true},
+		{"90%", "900Mi", limited, false},
+		{"90%", "950Mi", requested, true},
+		{"90%", "950Mi", corev1.ResourceRequirements{}, false},
+		{"512Mi", "600Mi", corev1.ResourceRequirements{}, true},
+		{"512Mi", "512Mi", limited, false},
+	}
+	for _, tt := range tests {
+		threshold, err := ParseUsageThreshold(tt.threshold)
+		if err != nil {
+			t.Fatalf("ParseUsageThreshold(%q): %v", tt.threshold, err)
+		}
+		if _, got := threshold.exceeded(resource.MustParse(tt.usage), corev1.ResourceMemory, tt.resources); got != tt.want {
+			t.Errorf("%s exceeds %s with %+v = %t, want %t", tt.usage, tt.threshold, tt.resources, got, tt.want)
+		}
+	}
+}
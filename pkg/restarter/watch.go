@@ -0,0 +1,201 @@
+package restarter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+type podWatcher struct {
+	r *Restarter
+
+	mu          sync.Mutex
+	resolver    *ownerResolver
+	lastRestart map[string]time.Time
+	// restarting holds the workloads being restarted, which run outside the
+	// informer's handler so pod events keep being delivered meanwhile.
+	restarting map[string]bool
+	wg         sync.WaitGroup
+}
+
+// Watch restarts the workloads of matching pods that enter CrashLoopBackOff
+// or exceed the restart threshold, until ctx is cancelled.
+func (r *Restarter) Watch(ctx context.Context, namespaces []string) error {
+	if err := r.selectNodes(ctx); err != nil {
+		return err
+	}
+	if err := r.selectClaims(ctx, namespaces); err != nil {
+		return err
+	}
+	pw := &podWatcher{
+		r:           r,
+		resolver:    newOwnerResolver(r.clientset, r.opts.Cache, r.customKinds()),
+		lastRestart: map[string]time.Time{},
+		restarting:  map[string]bool{},
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			pw.handle(ctx, obj.(*corev1.Pod))
+		},
+		UpdateFunc: func(_, obj any) {
+			pw.handle(ctx, obj.(*corev1.Pod))
+		},
+	}
+	for _, namespace := range namespaces {
+		// The Cache's pod informer already watches the namespace; its pods
+		// only need the label selector applied.
+		if r.opts.Cache.covers(namespace) && r.opts.FieldSelector == "" {
+			selector, err := labels.Parse(r.labelSelector())
+			if err != nil {
+				return err
+			}
+			_, err = r.opts.Cache.podInformer.AddEventHandler(cache.FilteringResourceEventHandler{
+				FilterFunc: func(obj any) bool {
+					pod, ok := obj.(*corev1.Pod)
+					return ok && (namespace == metav1.NamespaceAll || pod.Namespace == namespace) && selector.Matches(labels.Set(pod.Labels))
+				},
+				Handler: handler,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		factory := informers.NewSharedInformerFactoryWithOptions(r.clientset, 0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+				lo.LabelSelector = r.labelSelector()
+				lo.FieldSelector = r.opts.FieldSelector
+			}),
+		)
+		_, err := factory.Core().V1().Pods().Informer().AddEventHandler(handler)
+		if err != nil {
+			return err
+		}
+		factory.Start(ctx.Done())
+		for typ, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("failed to sync %v informer", typ)
+			}
+		}
+	}
+
+	r.log.Info("Watching for crash-looping pods", "namespaces", strings.Join(namespaces, ","))
+	<-ctx.Done()
+	r.log.Info("Stopping watch")
+	pw.wg.Wait()
+	return nil
+}
+
+func (pw *podWatcher) handle(ctx context.Context, pod *corev1.Pod) {
+	r := pw.r
+	reason, ok := r.MatchPod(pod)
+	if !ok {
+		return
+	}
+	unhealthy := unhealthyReason(pod, r.opts.RestartThreshold)
+	if unhealthy == "" {
+		return
+	}
+
+	owner, err := pw.resolver.resolve(ctx, pod)
+	if err != nil {
+		r.log.Warn("Skipping pod, owner lookup failed", "pod", pod.Namespace+"/"+pod.Name, "error", err)
+		return
+	}
+	if owner == nil || !r.restartableKind(owner.Kind) {
+		return
+	}
+
+	w := r.newWorkload(owner.Kind, pod.Namespace, owner.Name, reason+", "+unhealthy)
+	w.Pods = []string{pod.Name}
+	w.apiVersion, w.uid = owner.APIVersion, owner.UID
+	w.podLabels = pod.Labels
+	pw.mu.Lock()
+	due := pw.due(w.key())
+	pw.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if reason := r.exclusionReason(w); reason != "" {
+		r.log.Debug("Ignoring unhealthy pod of excluded workload", "workload", w.String(), "reason", reason)
+		return
+	}
+
+	r.log.Info("Pod is unhealthy", "pod", pod.Namespace+"/"+pod.Name, "reason", unhealthy)
+	obj, err := r.getWorkloadMeta(ctx, w)
+	if err != nil {
+		r.log.Warn("Skipping workload, lookup failed", "workload", w.String(), "error", err)
+		return
+	}
+	if reason := optOutReason(obj.GetAnnotations()); reason != "" {
+		r.log.Info("Skipping opted-out workload", "workload", w.String(), "reason", reason)
+		return
+	}
+	if !pw.claim(w.key()) {
+		return
+	}
+	if r.opts.DryRun {
+		r.log.Info("Dry run, not restarting", "workload", w.String())
+		pw.release(w.key())
+		return
+	}
+
+	pw.wg.Add(1)
+	go func() {
+		defer pw.wg.Done()
+		defer pw.release(w.key())
+		if err := r.Restart(ctx, w); err != nil {
+			r.log.Error("Restart of unhealthy workload failed", "workload", w.String(), "error", err)
+		}
+	}()
+}
+
+// due reports whether the workload with key is neither being restarted nor
+// within its cooldown. pw.mu must be held.
+func (pw *podWatcher) due(key string) bool {
+	last, ok := pw.lastRestart[key]
+	return !pw.restarting[key] && (!ok || time.Since(last) >= pw.r.opts.WatchCooldown)
+}
+
+// claim marks the workload with key as being restarted if it is still due;
+// another event for it may have got there first.
+func (pw *podWatcher) claim(key string) bool {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if !pw.due(key) {
+		return false
+	}
+	pw.restarting[key] = true
+	return true
+}
+
+// release ends the restart of the workload with key, starting its cooldown.
+func (pw *podWatcher) release(key string) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	delete(pw.restarting, key)
+	pw.lastRestart[key] = time.Now()
+}
+
+func unhealthyReason(pod *corev1.Pod, restartThreshold int32) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+			return fmt.Sprintf("container %s is in CrashLoopBackOff", status.Name)
+		}
+		if restartThreshold > 0 && status.RestartCount >= restartThreshold {
+			return fmt.Sprintf("container %s has restarted %d times", status.Name, status.RestartCount)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package restarter
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Workload is a controller whose pods matched, along with what was done to it.
+type Workload struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Reason    string   `json:"reason"`
+	Pods      []string `json:"pods"`
+	Action    string   `json:"action"`
+	Result    string   `json:"result,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Duration  string   `json:"duration,omitempty"`
+
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// ManagedBy names the Argo CD Application or Flux object applying the
+	// workload, if any.
+	ManagedBy string `json:"managedBy,omitempty"`
+
+	// DependsOn lists the workloads in the same plan that are restarted,
+	// and waited for, before this one.
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// Hooks records the last run of each hook in each pod.
+	Hooks []HookResult `json:"hooks,omitempty"`
+
+	apiVersion string
+	uid        types.UID
+	podLabels  map[string]string
+	configHash string
+	paused     bool
+	onDelete   bool
+	propagated bool
+	argoCDApp  *gitOpsOwner
+	// patched is set once this run has changed the workload, so OnError
+	// rollbacks leave workloads that failed before that alone.
+	patched bool
+
+	dependencies  []*Workload
+	hasDependents bool
+	level         int
+}
+
+// HookResult is the outcome of a pre-hook, switchover hook or post-hook in
+// one pod.
+type HookResult struct {
+	Hook     string `json:"hook"`
+	Pod      string `json:"pod"`
+	ExitCode int    `json:"exitCode,omitempty"`
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// PodResult classifies what a run did with a pod, so automation can react
+// to specific skip causes.
+type PodResult string
+
+const (
+	PodMatched              PodResult = "Matched"
+	SkippedNoOwner          PodResult = "SkippedNoOwner"
+	SkippedUnsupportedKind  PodResult = "SkippedUnsupportedKind"
+	SkippedExcluded         PodResult = "SkippedExcluded"
+	SkippedCooldown         PodResult = "SkippedCooldown"
+	SkippedPaused           PodResult = "SkippedPaused"
+	SkippedPropagated       PodResult = "SkippedPropagated"
+	SkippedUnchanged        PodResult = "SkippedUnchanged"
+	SkippedDependencyCycle  PodResult = "SkippedDependencyCycle"
+	SkippedAlreadyRestarted PodResult = "SkippedAlreadyRestarted"
+	PodErrored              PodResult = "Errored"
+)
+
+// SkippedPod is a matching pod whose workload will not be restarted.
+type SkippedPod struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Result    PodResult `json:"result"`
+	Reason    string    `json:"reason"`
+}
+
+func (w *Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+func (r *Restarter) newWorkload(kind, namespace, name, reason string) *Workload {
+	w := &Workload{Kind: kind, Namespace: namespace, Name: name, Reason: reason, Action: "restart"}
+	switch {
+	case kind == "Job":
+		w.Action = "recreate"
+	case kind == "CronJob":
+		w.Action = "trigger"
+	case operatorClusters[kind].restart != nil:
+		w.Action = "operator-restart"
+	case r.opts.Strategy == "delete-pods", r.opts.Strategy == "evict":
+		w.Action = r.opts.Strategy
+	case r.opts.Strategy == "scale-bounce" && scaleBounceApplies(kind):
+		w.Action = r.opts.Strategy
+	case (r.opts.Ordered || r.opts.RoleLabel != "") && kind == "StatefulSet":
+		w.Action = "ordered-restart"
+	case r.opts.Partitioned && kind == "StatefulSet":
+		w.Action = "partitioned-restart"
+	}
+	return w
+}
+
+func (w *Workload) key() string {
+	return w.Kind + "/" + w.Namespace + "/" + w.Name
+}
+
+func (r *Restarter) restartableKind(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob", "Rollout", "DeploymentConfig":
+		return true
+	}
+	if _, ok := operatorClusters[kind]; ok {
+		return true
+	}
+	_, ok := r.customOwner(kind)
+	return ok
+}
+
+func (w *Workload) fail(err error, start time.Time) {
+	w.Result = "failed"
+	w.Error = err.Error()
+	w.Duration = time.Since(start).String()
+}
+
+func (w *Workload) skipPods(result PodResult, reason string) []SkippedPod {
+	var skipped []SkippedPod
+	for _, pod := range w.Pods {
+		skipped = append(skipped, SkippedPod{Namespace: w.Namespace, Name: pod, Result: result, Reason: reason})
+	}
+	return skipped
+}
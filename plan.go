@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+func printPlan(out io.Writer, plan []*restarter.Workload) {
+	if len(plan) == 0 {
+		fmt.Fprintln(out, "No workloads would be restarted")
+		return
+	}
+
+	fmt.Fprintln(out, "The following workloads would be restarted:")
+	for _, w := range plan {
+		fmt.Fprintf(out, "  %s: %s (%s)\n", w.Action, w, w.Reason)
+		fmt.Fprintf(out, "    pods: %s\n", strings.Join(w.Pods, ", "))
+		if len(w.DependsOn) > 0 {
+			fmt.Fprintf(out, "    after: %s\n", strings.Join(w.DependsOn, ", "))
+		}
+		if w.ManagedBy != "" {
+			fmt.Fprintf(out, "    managed by: %s\n", w.ManagedBy)
+		}
+	}
+}
+
+// printSkipped lists the skipped pods grouped by result, so it is clear why
+// each was left alone.
+func printSkipped(out io.Writer, skipped []restarter.SkippedPod) {
+	if len(skipped) == 0 {
+		return
+	}
+	byResult := map[restarter.PodResult][]restarter.SkippedPod{}
+	var results []string
+	for _, pod := range skipped {
+		if _, ok := byResult[pod.Result]; !ok {
+			results = append(results, string(pod.Result))
+		}
+		byResult[pod.Result] = append(byResult[pod.Result], pod)
+	}
+	sort.Strings(results)
+
+	fmt.Fprintln(out, "The following pods were skipped:")
+	for _, result := range results {
+		fmt.Fprintf(out, "  %s:\n", result)
+		for _, pod := range byResult[restarter.PodResult(result)] {
+			fmt.Fprintf(out, "    %s/%s (%s)\n", pod.Namespace, pod.Name, pod.Reason)
+		}
+	}
+}
+
+// printDiffs writes the diff of each workload whose template the restart
+// changes.
+func printDiffs(ctx context.Context, out io.Writer, r *restarter.Restarter, plan []*restarter.Workload) {
+	for _, w := range plan {
+		diff, err := r.Diff(ctx, w)
+		if err != nil {
+			slog.Warn("Could not diff workload", "workload", w.String(), "error", err)
+			continue
+		}
+		fmt.Fprint(out, diff)
+	}
+}
+
+func confirmPlan(ctx context.Context, in io.Reader, out io.Writer, plan []*restarter.Workload) bool {
+	printPlan(out, plan)
+	fmt.Fprintf(out, "Restart %d workload(s)? [y/N]: ", len(plan))
+
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answers <- answer
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(out)
+		return false
+	case answer := <-answers:
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		}
+		return false
+	}
+}
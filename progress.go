@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+const progressRefresh = 500 * time.Millisecond
+
+// activeProgress is the progress table being drawn, if any; logSink routes
+// log lines through it so they appear above the table instead of over it.
+var activeProgress atomic.Pointer[progressUI]
+
+type logSink struct{}
+
+func (logSink) Write(p []byte) (int, error) {
+	if ui := activeProgress.Load(); ui != nil {
+		return ui.Write(p)
+	}
+	return logOutput.Write(p)
+}
+
+type progressRow struct {
+	restarter.Progress
+	took time.Duration
+}
+
+func (row *progressRow) elapsed() string {
+	switch {
+	case row.took > 0:
+		return row.took.Round(time.Second).String()
+	case row.Started.IsZero():
+		return "-"
+	default:
+		return time.Since(row.Started).Round(time.Second).String()
+	}
+}
+
+func (row *progressRow) counts() string {
+	if row.Rollout == nil {
+		return ""
+	}
+	return fmt.Sprintf("updated %d/%d, ready %d/%d", row.Rollout.Updated, row.Rollout.Desired, row.Rollout.Ready, row.Rollout.Desired)
+}
+
+// progressUI shows the rollout of every workload in a restart, as a table
+// redrawn in place on a terminal or as one line per change otherwise.
+type progressUI struct {
+	mu    sync.Mutex
+	out   io.Writer
+	tty   bool
+	rows  []*progressRow
+	index map[string]*progressRow
+	drawn int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newProgressUI(out io.Writer, plan []*restarter.Workload) *progressUI {
+	ui := &progressUI{out: out, index: map[string]*progressRow{}, stop: make(chan struct{}), done: make(chan struct{})}
+	if f, ok := out.(*os.File); ok {
+		ui.tty = term.IsTerminal(int(f.Fd()))
+	}
+	for _, w := range plan {
+		row := &progressRow{Progress: restarter.Progress{Workload: w.String(), Phase: "pending"}}
+		ui.rows = append(ui.rows, row)
+		ui.index[row.Workload] = row
+	}
+
+	if !ui.tty {
+		close(ui.done)
+		return ui
+	}
+	activeProgress.Store(ui)
+	go func() {
+		defer close(ui.done)
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ui.stop:
+				return
+			case <-ticker.C:
+				ui.mu.Lock()
+				ui.redraw()
+				ui.mu.Unlock()
+			}
+		}
+	}()
+	return ui
+}
+
+func (ui *progressUI) update(p restarter.Progress) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+
+	row, ok := ui.index[p.Workload]
+	if !ok {
+		return
+	}
+	before := row.Phase + row.counts()
+	row.Progress = p
+	if p.Phase == "succeeded" || p.Phase == "failed" {
+		row.took = time.Since(p.Started)
+	}
+	if ui.tty {
+		ui.redraw()
+	} else if row.Phase+row.counts() != before {
+		ui.printLine(row)
+	}
+}
+
+// finish records the workloads that were never started, draws the final
+// state and stops routing logs through the table.
+func (ui *progressUI) finish(plan []*restarter.Workload) {
+	if ui.tty {
+		activeProgress.CompareAndSwap(ui, nil)
+		close(ui.stop)
+	}
+	<-ui.done
+
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	for _, w := range plan {
+		if row := ui.index[w.String()]; row.Phase == "pending" && w.Result != "" {
+			row.Phase = w.Result
+			if !ui.tty {
+				ui.printLine(row)
+			}
+		}
+	}
+	if ui.tty {
+		ui.redraw()
+		ui.drawn = 0
+	}
+}
+
+// Write prints log lines above the table.
+func (ui *progressUI) Write(p []byte) (int, error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.clear()
+	n, err := ui.out.Write(p)
+	ui.redraw()
+	return n, err
+}
+
+func (ui *progressUI) printLine(row *progressRow) {
+	fields := []string{row.Workload + ":", row.Phase}
+	if counts := row.counts(); counts != "" {
+		fields = append(fields, counts+",")
+	}
+	fields = append(fields, row.elapsed())
+	fmt.Fprintln(ui.out, strings.Join(fields, " "))
+}
+
+func (ui *progressUI) clear() {
+	if ui.drawn > 0 {
+		fmt.Fprintf(ui.out, "\x1b[%dA\x1b[J", ui.drawn)
+		ui.drawn = 0
+	}
+}
+
+func (ui *progressUI) redraw() {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKLOAD\tUPDATED\tREADY\tDESIRED\tELAPSED\tSTATUS")
+	for _, row := range ui.rows {
+		updated, ready, desired := "-", "-", "-"
+		if row.Rollout != nil {
+			updated, ready, desired = fmt.Sprint(row.Rollout.Updated), fmt.Sprint(row.Rollout.Ready), fmt.Sprint(row.Rollout.Desired)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Workload, updated, ready, desired, row.elapsed(), row.Phase)
+	}
+	tw.Flush()
+
+	ui.clear()
+	ui.drawn = bytes.Count(buf.Bytes(), []byte("\n"))
+	ui.out.Write(buf.Bytes())
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+var logOutput io.Writer = os.Stdout
+
+type report struct {
+	Context    string                 `json:"context,omitempty"`
+	RunID      string                 `json:"runId,omitempty"`
+	Initiator  string                 `json:"initiator,omitempty"`
+	StartedAt  time.Time              `json:"startedAt"`
+	FinishedAt time.Time              `json:"finishedAt"`
+	Duration   string                 `json:"duration"`
+	DryRun     bool                   `json:"dryRun"`
+	Workloads  []*restarter.Workload  `json:"workloads"`
+	Skipped    []restarter.SkippedPod `json:"skipped,omitempty"`
+	// Pods counts the matched and skipped pods by result.
+	Pods  map[restarter.PodResult]int `json:"pods,omitempty"`
+	Error string                      `json:"error,omitempty"`
+}
+
+// finish records when the run ended and tallies its pods.
+func (rep *report) finish() {
+	rep.FinishedAt = time.Now()
+	rep.Duration = rep.FinishedAt.Sub(rep.StartedAt).String()
+	rep.Pods = map[restarter.PodResult]int{}
+	for _, w := range rep.Workloads {
+		rep.Pods[restarter.PodMatched] += len(w.Pods)
+	}
+	for _, pod := range rep.Skipped {
+		rep.Pods[pod.Result]++
+	}
+}
+
+func writeReport(w io.Writer, format string, rep any) error {
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(rep, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(rep)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// writeReportFile writes the reports of a run, one per context, to path in
+// the format its extension names.
+func writeReportFile(path string, reports []*report) error {
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = reportHTML.Execute(&buf, reports)
+	case ".yaml", ".yml":
+		err = writeReport(&buf, "yaml", reports)
+	default:
+		err = writeReport(&buf, "json", reports)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"hooks": func(workloads []*restarter.Workload) bool {
+		for _, w := range workloads {
+			if len(w.Hooks) > 0 {
+				return true
+			}
+		}
+		return false
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Restart report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.succeeded { color: #1a7f37; }
+.failed { color: #cf222e; }
+.skipped { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>Restart report</h1>
+{{range .}}
+<h2>{{if .Context}}Context {{.Context}}{{else}}Current context{{end}}{{if .DryRun}} (dry run){{end}}</h2>
+<p>
+{{if .RunID}}Run ID: {{.RunID}}<br>{{end}}
+{{if not .StartedAt.IsZero}}Started: {{time .StartedAt}}<br>
+Finished: {{time .FinishedAt}}<br>
+Duration: {{.Duration}}{{end}}
+</p>
+{{if .Error}}<p class="failed">Error: {{.Error}}</p>{{end}}
+<table>
+<tr><th>Workload</th><th>Pods</th><th>Reason</th><th>Action</th><th>Result</th><th>Duration</th><th>Rollout</th><th>Error</th></tr>
+{{range .Workloads}}
+<tr>
+<td>{{.Kind}} {{.Namespace}}/{{.Name}}</td>
+<td>{{range .Pods}}{{.}}<br>{{end}}</td>
+<td>{{.Reason}}</td>
+<td>{{.Action}}</td>
+<td class="{{.Result}}">{{.Result}}</td>
+<td>{{.Duration}}</td>
+<td>{{with .Rollout}}{{.Ready}}/{{.Desired}} ready{{if .Complete}}, complete{{end}}{{end}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{else}}
+<tr><td colspan="8">No workloads matched</td></tr>
+{{end}}
+</table>
+{{if hooks .Workloads}}
+<table>
+<tr><th>Workload</th><th>Hook</th><th>Pod</th><th>Exit code</th><th>Duration</th><th>Output</th><th>Error</th></tr>
+{{range $w := .Workloads}}{{range .Hooks}}
+<tr>
+<td>{{$w.Kind}} {{$w.Namespace}}/{{$w.Name}}</td>
+<td>{{.Hook}}</td>
+<td>{{.Pod}}</td>
+<td{{if .Error}} class="failed"{{end}}>{{.ExitCode}}</td>
+<td>{{.Duration}}</td>
+<td>{{if .Stdout}}<pre>{{.Stdout}}</pre>{{end}}{{if .Stderr}}<pre class="failed">{{.Stderr}}</pre>{{end}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}{{end}}
+</table>
+{{end}}
+{{if .Skipped}}
+<table>
+<tr><th>Skipped pod</th><th>Result</th><th>Reason</th></tr>
+{{range .Skipped}}
+<tr><td>{{.Namespace}}/{{.Name}}</td><td>{{.Result}}</td><td>{{.Reason}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
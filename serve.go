@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+type serveOptions struct {
+	listen            string
+	tokenFile         string
+	tlsCert           string
+	tlsKey            string
+	allowedNamespaces []string
+
+	slackSigningSecretFile string
+	slackBotTokenFile      string
+	slackChannels          []string
+}
+
+// restartRequest is the body of POST /restart.
+type restartRequest struct {
+	Namespaces []string `json:"namespaces"`
+	Context    string   `json:"context,omitempty"`
+	Selector   string   `json:"selector,omitempty"`
+	Match      []string `json:"match,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	DryRun     bool     `json:"dryRun,omitempty"`
+}
+
+type server struct {
+	ctx     context.Context
+	opts    *options
+	serve   *serveOptions
+	clients map[string]string
+	slack   *slackConfig
+
+	// restarting allows a single restart at a time; dry runs do not take it.
+	restarting sync.Mutex
+}
+
+func newServeCommand(opts *options) *cobra.Command {
+	serveOpts := &serveOptions{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an authenticated HTTP API that restarts the workloads behind matching pods",
+		Long: `Serve an authenticated HTTP API that restarts the workloads behind matching pods.
+
+POST /restart with a bearer token from --token-file and a JSON body such as
+{"namespaces": ["payments"], "selector": "app=postgres", "dryRun": true}
+plans, and unless dryRun is set performs, a restart with the server's
+restart flags and responds with the same report as --output json. Only one
+restart runs at a time; others get 409 Conflict. GET /healthz needs no token.
+Restarts are refused outside --window with 503 Service Unavailable, and
+their results are sent to --notify-webhook.
+A context can be given when the server was started with --contexts.
+
+With --slack-signing-secret-file, POST /slack/command serves a Slack slash
+command, /restart-db NAMESPACE [CONTEXT], that posts the plan with Restart
+and Cancel buttons handled by POST /slack/interactive, and with
+--slack-bot-token-file posts the progress in the plan's thread. A Restart
+button expires after 15 minutes and is refused if the workloads to restart
+have changed since the plan was posted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), opts, serveOpts)
+		},
+	}
+	addRestartFlags(cmd, opts)
+	cmd.Flags().StringVar(&serveOpts.listen, "listen", ":8080", "address to serve the API on")
+	cmd.Flags().StringVar(&serveOpts.tokenFile, "token-file", "", "file with one bearer token per line, optionally prefixed with a client name and a colon (ci:s3cr3t); enables POST /restart")
+	cmd.Flags().StringVar(&serveOpts.tlsCert, "tls-cert", "", "serve HTTPS with this certificate file")
+	cmd.Flags().StringVar(&serveOpts.tlsKey, "tls-key", "", "serve HTTPS with this key file")
+	cmd.Flags().StringArrayVar(&serveOpts.allowedNamespaces, "allow-namespace", nil, "namespace glob requests may target, repeatable (defaults to any namespace)")
+	cmd.Flags().BoolVar(&opts.wait, "wait", false, "wait for each restarted workload to finish rolling out before responding")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for each rollout when --wait is set, or for each pod when --ordered or a pod --strategy is set")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 1, "number of workloads to restart in parallel")
+	cmd.Flags().StringVar(&opts.windowSpec, "window", "", "refuse restart requests outside this maintenance window, e.g. \"Sat 02:00-04:00 America/New_York\"")
+	cmd.Flags().StringVar(&opts.notifyWebhook, "notify-webhook", "", "post a summary of each requested restart's results to this webhook URL")
+	cmd.Flags().StringVar(&opts.notifyFormat, "notify-format", "slack", "payload for --notify-webhook: slack (a Slack-compatible text message), json (the full report) or template (--notify-template)")
+	cmd.Flags().StringVar(&opts.notifyTemplate, "notify-template", "", "Go template rendering the --notify-webhook payload from .Reports, .RunID, .Initiator and .Summary (the slack text), e.g. '{\"text\": {{json .Summary}}}'; implies --notify-format template")
+	cmd.Flags().StringVar(&serveOpts.slackSigningSecretFile, "slack-signing-secret-file", "", "file with the Slack app's signing secret; enables the Slack slash command")
+	cmd.Flags().StringVar(&serveOpts.slackBotTokenFile, "slack-bot-token-file", "", "file with the Slack bot token used to post restart progress in the plan's thread")
+	cmd.Flags().StringArrayVar(&serveOpts.slackChannels, "slack-channel", nil, "Slack channel ID and the namespace globs it may restart, e.g. C0123456=payments,orders-*; repeatable")
+	return cmd
+}
+
+func runServe(ctx context.Context, opts *options, serveOpts *serveOptions) error {
+	if (serveOpts.tlsCert == "") != (serveOpts.tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+	for _, namespace := range serveOpts.allowedNamespaces {
+		if _, err := path.Match(namespace, ""); err != nil {
+			return fmt.Errorf("invalid --allow-namespace %q: %w", namespace, err)
+		}
+	}
+	if serveOpts.tokenFile == "" && serveOpts.slackSigningSecretFile == "" {
+		return fmt.Errorf("serve needs --token-file, --slack-signing-secret-file or both")
+	}
+
+	opts.caches = newCacheSet(ctx)
+	s := &server{ctx: ctx, opts: opts, serve: serveOpts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	if serveOpts.tokenFile != "" {
+		clients, err := loadTokens(serveOpts.tokenFile)
+		if err != nil {
+			return err
+		}
+		s.clients = clients
+		mux.HandleFunc("POST /restart", s.handleRestart)
+	}
+	if serveOpts.slackSigningSecretFile != "" {
+		slack, err := loadSlackConfig(serveOpts)
+		if err != nil {
+			return err
+		}
+		s.slack = slack
+		mux.HandleFunc("POST /slack/command", s.handleSlackCommand)
+		mux.HandleFunc("POST /slack/interactive", s.handleSlackInteraction)
+	}
+
+	srv := &http.Server{Addr: serveOpts.listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving restart API", "address", serveOpts.listen, "tls", serveOpts.tlsCert != "", "clients", len(s.clients), "slack", s.slack != nil)
+	var err error
+	if serveOpts.tlsCert != "" {
+		err = srv.ListenAndServeTLS(serveOpts.tlsCert, serveOpts.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		slog.Info("Stopped serving restart API")
+		return nil
+	}
+	return err
+}
+
+// loadTokens reads the token file into a map from token to client name.
+func loadTokens(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	clients := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, token, ok := strings.Cut(line, ":")
+		if !ok {
+			name, token = fmt.Sprintf("token-%d", n), line
+		}
+		clients[token] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", path)
+	}
+	return clients, nil
+}
+
+// authenticate returns the name of the client whose token the request
+// carries, or "" when it carries none or an unknown one.
+func (s *server) authenticate(req *http.Request) string {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	client := ""
+	for known, name := range s.clients {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			client = name
+		}
+	}
+	return client
+}
+
+func (s *server) handleRestart(w http.ResponseWriter, req *http.Request) {
+	client := s.authenticate(req)
+	if client == "" {
+		httpError(w, http.StatusUnauthorized, "missing or unknown bearer token")
+		return
+	}
+
+	var body restartRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		httpError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	o, err := s.requestOptions(client, &body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !body.DryRun {
+		if !s.restarting.TryLock() {
+			httpError(w, http.StatusConflict, "another restart is in progress")
+			return
+		}
+		defer s.restarting.Unlock()
+	}
+
+	slog.Info("Restart requested through the API", "client", client, "namespaces", strings.Join(o.namespaces, ","), "selector", o.selector, "dryRun", o.dryRun)
+	// Restarts continue when the client disconnects; only stopping the
+	// server interrupts them.
+	rep, err := serveRestart(s.ctx, o, nil)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var refused *requestError
+		if errors.As(err, &refused) {
+			status = refused.status
+		}
+		httpError(w, status, err.Error())
+		return
+	}
+	status := http.StatusOK
+	if rep.Error != "" {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeReport(w, "json", rep)
+}
+
+// requestOptions applies a request to a copy of the server's options.
+func (s *server) requestOptions(client string, body *restartRequest) (*options, error) {
+	if len(body.Namespaces) == 0 {
+		return nil, fmt.Errorf("namespaces is required")
+	}
+	for _, namespace := range body.Namespaces {
+		// An empty name would list pods in every namespace.
+		if namespace == "" {
+			return nil, fmt.Errorf("namespaces must not contain an empty name")
+		}
+		if !s.namespaceAllowed(namespace) {
+			return nil, fmt.Errorf("namespace %q is not allowed", namespace)
+		}
+	}
+
+	if body.Context != "" && !slices.Contains(s.opts.contexts, body.Context) {
+		return nil, fmt.Errorf("context %q is not one the server was started with", body.Context)
+	}
+
+	o := *s.opts
+	if body.Context != "" {
+		o.context = body.Context
+	} else if len(s.opts.contexts) > 0 {
+		o.context = s.opts.contexts[0]
+	}
+	o.namespaces = body.Namespaces
+	o.allNamespaces = false
+	if _, err := labels.Parse(body.Selector); err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	o.selector = body.Selector
+	o.dryRun = body.DryRun
+	o.yes = true
+	o.progress = nil
+	o.state = nil
+	o.runID = restarter.NewRunID()
+	// Outside the window a request fails rather than holding the restart
+	// lock until the window opens.
+	o.waitForWindow = false
+	o.reason = body.Reason
+	if o.reason == "" {
+		o.reason = "requested by " + client + " through the API"
+	}
+
+	match := body.Match
+	if len(match) == 0 && body.Selector == "" {
+		match = []string{"*database*"}
+	}
+	o.patterns = nil
+	for _, raw := range match {
+		pattern, err := restarter.ParseNamePattern(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern: %w", err)
+		}
+		o.patterns = append(o.patterns, pattern)
+	}
+	return &o, nil
+}
+
+func (s *server) namespaceAllowed(namespace string) bool {
+	if len(s.serve.allowedNamespaces) == 0 {
+		return true
+	}
+	for _, allowed := range s.serve.allowedNamespaces {
+		if matched, _ := path.Match(allowed, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// requestError is a restart request the server refused rather than failed
+// to carry out, with the status to respond with.
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// serveRestart plans a restart and, once check, when given, has accepted the
+// plan, performs it unless o.dryRun is set.
+func serveRestart(ctx context.Context, o *options, check func(*report) error) (*report, error) {
+	if !o.dryRun {
+		if err := o.enforceWindow(ctx); err != nil {
+			return nil, &requestError{status: http.StatusServiceUnavailable, err: err}
+		}
+	}
+	r, rep, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(rep); err != nil {
+			return nil, &requestError{status: http.StatusConflict, err: err}
+		}
+	}
+	if !o.dryRun && len(rep.Workloads) > 0 {
+		if failed := r.RestartAll(ctx, rep.Workloads); len(failed) > 0 {
+			rep.Error = fmt.Sprintf("%d of %d workload restart(s) failed", len(failed), len(rep.Workloads))
+		}
+	}
+	rep.Context = o.context
+	rep.finish()
+	o.notify([]*report{rep})
+	return rep, nil
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
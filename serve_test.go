@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestOptionsNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		namespaces []string
+		selector   string
+		wantErr    bool
+	}{
+		{name: "any namespace", namespaces: []string{"payments"}},
+		{name: "missing", wantErr: true},
+		{name: "empty name", namespaces: []string{""}, wantErr: true},
+		{name: "empty name among others", namespaces: []string{"payments", ""}, wantErr: true},
+		{name: "allowed glob", allowed: []string{"orders-*"}, namespaces: []string{"orders-eu"}},
+		{name: "not allowed", allowed: []string{"orders-*"}, namespaces: []string{"payments"}, wantErr: true},
+		{name: "selector", namespaces: []string{"payments"}, selector: "app=postgres,tier!=cache"},
+		{name: "invalid selector", namespaces: []string{"payments"}, selector: "app in (postgres", wantErr: true},
+	}
+	for _, tt := range tests {
+		s := &server{opts: &options{}, serve: &serveOptions{allowedNamespaces: tt.allowed}}
+		o, err := s.requestOptions("ci", &restartRequest{Namespaces: tt.namespaces, Selector: tt.selector})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: requestOptions error = %v, wantErr %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && o.waitForWindow {
+			t.Errorf("%s: requestOptions would wait for the window", tt.name)
+		}
+	}
+}
+
+func TestServeRestartOutsideWindow(t *testing.T) {
+	// A window three days from now is closed whatever the time zone.
+	day := strings.ToLower(time.Now().Add(72 * time.Hour).Weekday().String()[:3])
+	window, err := parseWindow(day + " 02:00-04:00 UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = serveRestart(context.Background(), &options{window: window}, nil)
+	var refused *requestError
+	if !errors.As(err, &refused) || refused.status != http.StatusServiceUnavailable {
+		t.Errorf("serveRestart outside the window = %v, want a %d request error", err, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+const slackAPI = "https://slack.com/api/"
+
+// slackPlanTTL is how long a posted plan's Restart button stays usable.
+const slackPlanTTL = 15 * time.Minute
+
+var errPlanChanged = errors.New("the workloads to restart have changed since the plan was posted")
+
+// slackConfig holds the Slack app credentials and which namespaces each
+// channel may restart.
+type slackConfig struct {
+	signingSecret []byte
+	botToken      string
+	channels      map[string][]string
+}
+
+// slackInteraction is the part of a Slack block action payload the
+// confirm and cancel buttons need.
+type slackInteraction struct {
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Container struct {
+		MessageTS string `json:"message_ts"`
+	} `json:"container"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// slackPlan is the value of a plan's Restart button: the request along with
+// the workloads it planned and when, so a click restarts only what was shown.
+type slackPlan struct {
+	Request   restartRequest `json:"request"`
+	Workloads string         `json:"workloads"`
+	PlannedAt int64          `json:"plannedAt"`
+}
+
+func loadSlackConfig(serveOpts *serveOptions) (*slackConfig, error) {
+	secret, err := os.ReadFile(serveOpts.slackSigningSecretFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &slackConfig{signingSecret: bytes.TrimSpace(secret), channels: map[string][]string{}}
+	if serveOpts.slackBotTokenFile != "" {
+		token, err := os.ReadFile(serveOpts.slackBotTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		config.botToken = strings.TrimSpace(string(token))
+	}
+	for _, raw := range serveOpts.slackChannels {
+		channel, namespaces, ok := strings.Cut(raw, "=")
+		if !ok || channel == "" || namespaces == "" {
+			return nil, fmt.Errorf("invalid --slack-channel %q: must be CHANNEL_ID=NAMESPACE[,NAMESPACE...]", raw)
+		}
+		for _, namespace := range strings.Split(namespaces, ",") {
+			if _, err := path.Match(namespace, ""); err != nil {
+				return nil, fmt.Errorf("invalid --slack-channel %q: %w", raw, err)
+			}
+			config.channels[channel] = append(config.channels[channel], namespace)
+		}
+	}
+	if len(config.channels) == 0 {
+		return nil, fmt.Errorf("--slack-signing-secret-file needs at least one --slack-channel")
+	}
+	return config, nil
+}
+
+// verifySlack checks the request signature Slack computes with the app's
+// signing secret and returns the request body.
+func (s *server) verifySlack(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	timestamp := req.Header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)).Abs() > 5*time.Minute {
+		http.Error(w, "stale or missing request timestamp", http.StatusUnauthorized)
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, s.slack.signingSecret)
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get("X-Slack-Signature"))) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
+
+func (s *server) slackAllowed(channel, namespace string) bool {
+	for _, allowed := range s.slack.channels[channel] {
+		if matched, _ := path.Match(allowed, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSlackCommand handles /restart-db NAMESPACE [CONTEXT]. It answers
+// at once, since Slack only waits three seconds, and posts the plan with
+// confirm and cancel buttons once it is ready.
+func (s *server) handleSlackCommand(w http.ResponseWriter, req *http.Request) {
+	body, ok := s.verifySlack(w, req)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) == 0 || len(args) > 2 {
+		slackReply(w, "Usage: "+form.Get("command")+" NAMESPACE [CONTEXT]")
+		return
+	}
+	request := restartRequest{Namespaces: args[:1], DryRun: true}
+	if len(args) == 2 {
+		request.Context = args[1]
+	}
+	if !s.slackAllowed(form.Get("channel_id"), request.Namespaces[0]) {
+		slackReply(w, fmt.Sprintf("Restarts in namespace %s are not allowed from this channel.", request.Namespaces[0]))
+		return
+	}
+	user := "<@" + form.Get("user_id") + ">"
+	request.Reason = "requested by " + form.Get("user_name") + " in Slack"
+	o, err := s.requestOptions("slack", &request)
+	if err != nil {
+		slackReply(w, err.Error())
+		return
+	}
+
+	slog.Info("Restart requested through Slack", "user", form.Get("user_name"), "channel", form.Get("channel_id"), "namespace", request.Namespaces[0], "context", request.Context)
+	slackReply(w, "Planning the restart…")
+	go s.postSlackPlan(o, request, user, form.Get("response_url"))
+}
+
+func (s *server) postSlackPlan(o *options, request restartRequest, user, responseURL string) {
+	rep, err := serveRestart(s.ctx, o, nil)
+	if err != nil {
+		s.respondSlack(responseURL, false, "Planning the restart failed: "+err.Error())
+		return
+	}
+	if len(rep.Workloads) == 0 {
+		s.respondSlack(responseURL, false, "No workloads match in namespace "+request.Namespaces[0]+".")
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s wants to restart in *%s*:\n", user, slackWhere(request))
+	for _, w := range rep.Workloads {
+		fmt.Fprintf(&b, "• %s (%d pods)\n", w, len(w.Pods))
+	}
+	request.DryRun = false
+	value, err := json.Marshal(slackPlan{Request: request, Workloads: slackPlanHash(rep.Workloads), PlannedAt: time.Now().Unix()})
+	if err != nil {
+		return
+	}
+	message := map[string]any{
+		"response_type": "in_channel",
+		"text":          b.String(),
+		"blocks": []any{
+			map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": b.String()}},
+			map[string]any{"type": "actions", "elements": []any{
+				map[string]any{"type": "button", "action_id": "confirm", "style": "danger", "value": string(value), "text": map[string]string{"type": "plain_text", "text": "Restart"}},
+				map[string]any{"type": "button", "action_id": "cancel", "text": map[string]string{"type": "plain_text", "text": "Cancel"}},
+			}},
+		},
+	}
+	if err := postWebhook(responseURL, message); err != nil {
+		slog.Warn("Could not post plan to Slack", "error", err)
+	}
+}
+
+// handleSlackInteraction handles the confirm and cancel buttons of a plan.
+func (s *server) handleSlackInteraction(w http.ResponseWriter, req *http.Request) {
+	body, ok := s.verifySlack(w, req)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil || len(interaction.Actions) == 0 {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	user := "<@" + interaction.User.ID + ">"
+	action := interaction.Actions[0]
+	if action.ActionID != "confirm" {
+		s.respondSlack(interaction.ResponseURL, true, "Restart cancelled by "+user+".")
+		return
+	}
+
+	var plan slackPlan
+	if err := json.Unmarshal([]byte(action.Value), &plan); err != nil || len(plan.Request.Namespaces) != 1 {
+		s.respondSlack(interaction.ResponseURL, true, "This restart request is invalid.")
+		return
+	}
+	if time.Since(time.Unix(plan.PlannedAt, 0)) > slackPlanTTL {
+		s.respondSlack(interaction.ResponseURL, true, "This plan has expired, run the command again for a fresh one.")
+		return
+	}
+	request := plan.Request
+	// The buttons can be pressed by anyone in the channel, so the channel is
+	// checked again.
+	if !s.slackAllowed(interaction.Channel.ID, request.Namespaces[0]) {
+		s.respondSlack(interaction.ResponseURL, false, "Restarts in namespace "+request.Namespaces[0]+" are not allowed from this channel.")
+		return
+	}
+	o, err := s.requestOptions("slack", &request)
+	if err != nil {
+		s.respondSlack(interaction.ResponseURL, false, err.Error())
+		return
+	}
+	go s.runSlackRestart(o, plan, user, interaction)
+}
+
+func (s *server) runSlackRestart(o *options, plan slackPlan, user string, interaction slackInteraction) {
+	request := plan.Request
+	if !s.restarting.TryLock() {
+		s.respondSlack(interaction.ResponseURL, false, "Another restart is in progress, try again once it has finished.")
+		return
+	}
+	defer s.restarting.Unlock()
+
+	s.respondSlack(interaction.ResponseURL, true, fmt.Sprintf("Restart in *%s* confirmed by %s, progress follows in the thread.", slackWhere(request), user))
+	slog.Info("Restart confirmed through Slack", "user", interaction.User.ID, "namespace", request.Namespaces[0], "context", request.Context)
+
+	thread := func(text string) {
+		if s.slack.botToken == "" {
+			return
+		}
+		if err := s.postSlackMessage(interaction.Channel.ID, interaction.Container.MessageTS, text); err != nil {
+			slog.Warn("Could not post restart progress to Slack", "error", err)
+		}
+	}
+	o.progressHook = func(p restarter.Progress) {
+		switch p.Phase {
+		case "restarting", "succeeded", "failed":
+			thread(fmt.Sprintf("%s: %s", p.Workload, p.Phase))
+		}
+	}
+
+	// Workloads that started or stopped matching since the plan was posted
+	// were not confirmed, so the restart is refused rather than re-planned.
+	rep, err := serveRestart(s.ctx, o, func(rep *report) error {
+		if slackPlanHash(rep.Workloads) != plan.Workloads {
+			return errPlanChanged
+		}
+		return nil
+	})
+	if errors.Is(err, errPlanChanged) {
+		s.respondSlack(interaction.ResponseURL, true, "Restart in *"+slackWhere(request)+"* refused: "+err.Error()+", run the command again.")
+		return
+	}
+	if err != nil {
+		thread("Restart failed: " + err.Error())
+		return
+	}
+	summary := slackSummary([]*report{rep})
+	if s.slack.botToken == "" {
+		s.respondSlack(interaction.ResponseURL, false, summary)
+		return
+	}
+	thread(summary)
+}
+
+// slackPlanHash identifies the workloads of a plan, in the order they are
+// restarted.
+func slackPlanHash(workloads []*restarter.Workload) string {
+	h := sha256.New()
+	for _, w := range workloads {
+		fmt.Fprintln(h, w.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func slackWhere(request restartRequest) string {
+	if request.Context == "" {
+		return request.Namespaces[0]
+	}
+	return request.Namespaces[0] + " (" + request.Context + ")"
+}
+
+// slackReply answers a slash command with a message only the user sees.
+func slackReply(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
+
+func (s *server) respondSlack(responseURL string, replace bool, text string) {
+	payload := map[string]any{"text": text, "replace_original": replace}
+	if !replace {
+		payload["response_type"] = "in_channel"
+	}
+	if err := postWebhook(responseURL, payload); err != nil {
+		slog.Warn("Could not respond in Slack", "error", err)
+	}
+}
+
+func (s *server) postSlackMessage(channel, threadTS, text string) error {
+	body, err := json.Marshal(map[string]string{"channel": channel, "thread_ts": threadTS, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, slackAPI+"chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.slack.botToken)
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("chat.postMessage failed: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+// runState records the workloads a run has restarted, per kubeconfig
+// context, so the run can be resumed with --resume after it was interrupted
+// or failed.
+type runState struct {
+	mu   sync.Mutex
+	path string
+
+	RunID     string              `json:"runId"`
+	Restarted map[string][]string `json:"restarted"`
+}
+
+func defaultStateDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "db-restarter", "runs")
+	}
+	return ""
+}
+
+// loadRunState reads the state of runID from dir; a missing file is only an
+// error when the run is being resumed.
+func loadRunState(dir, runID string, resume bool) (*runState, error) {
+	state := &runState{path: filepath.Join(dir, runID+".json"), RunID: runID, Restarted: map[string][]string{}}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if resume {
+			return nil, fmt.Errorf("no state recorded for run %s in %s", runID, dir)
+		}
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid run state %s: %w", state.path, err)
+	}
+	return state, nil
+}
+
+// pending drops the workloads already restarted in kubeContext from plan and
+// returns their pods as skipped.
+func (s *runState) pending(kubeContext string, plan []*restarter.Workload) ([]*restarter.Workload, []restarter.SkippedPod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining []*restarter.Workload
+	var skipped []restarter.SkippedPod
+	for _, w := range plan {
+		if !slices.Contains(s.Restarted[kubeContext], w.String()) {
+			remaining = append(remaining, w)
+			continue
+		}
+		slog.Info("Skipping workload already restarted in this run", "workload", w.String(), "runId", s.RunID)
+		// Its dependents in this plan may go ahead.
+		w.Result = "succeeded"
+		for _, pod := range w.Pods {
+			skipped = append(skipped, restarter.SkippedPod{Namespace: w.Namespace, Name: pod, Result: restarter.SkippedAlreadyRestarted, Reason: "already restarted in run " + s.RunID})
+		}
+	}
+	return remaining, skipped
+}
+
+func (s *runState) record(kubeContext, workload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Restarted[kubeContext] = append(s.Restarted[kubeContext], workload)
+	if err := s.save(); err != nil {
+		slog.Warn("Could not record run state, a resumed run will restart this workload again", "workload", workload, "error", err)
+	}
+}
+
+func (s *runState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *runState) remove() {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Could not remove run state", "path", s.path, "error", err)
+	}
+}
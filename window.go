@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type maintenanceWindow struct {
+	raw      string
+	days     map[time.Weekday]bool
+	start    int
+	end      int
+	location *time.Location
+}
+
+func parseWindow(raw string) (*maintenanceWindow, error) {
+	fields := strings.Fields(raw)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid window %q: expected \"<days> HH:MM-HH:MM [timezone]\"", raw)
+	}
+
+	w := &maintenanceWindow{raw: raw, days: map[time.Weekday]bool{}, location: time.Local}
+	for _, part := range strings.Split(fields[0], ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(part), "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q: unknown day %q", raw, from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("invalid window %q: unknown day %q", raw, to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	from, to, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q: expected a time range like 02:00-04:00", raw)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", raw, err)
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return nil, fmt.Errorf("invalid window %q: %w", raw, err)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid window %q: start and end are the same", raw)
+	}
+
+	if len(fields) == 3 {
+		if w.location, err = time.LoadLocation(fields[2]); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", raw, err)
+		}
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// The window crosses midnight, so it either started today or yesterday.
+	return (w.days[t.Weekday()] && minute >= w.start) ||
+		(w.days[(t.Weekday()+6)%7] && minute < w.end)
+}
+
+func (w *maintenanceWindow) next(t time.Time) time.Time {
+	t = t.In(w.location)
+	for i := 0; i <= 7; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, 0, w.start, 0, 0, w.location)
+		if w.days[start.Weekday()] && start.After(t) {
+			return start
+		}
+	}
+	return t
+}
+
+func (w *maintenanceWindow) String() string {
+	return w.raw
+}
+
+func (o *options) enforceWindow(ctx context.Context) error {
+	if o.window == nil {
+		return nil
+	}
+	now := time.Now()
+	if o.window.contains(now) {
+		return nil
+	}
+
+	next := o.window.next(now)
+	if !o.waitForWindow {
+		return fmt.Errorf("outside the maintenance window %q, next window opens at %s", o.window, next.Format(time.RFC3339))
+	}
+	slog.Info("Waiting for the maintenance window", "window", o.window.String(), "opens", next.Format(time.RFC3339))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(next)):
+		return nil
+	}
+}
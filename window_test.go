@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		raw        string
+		days       []time.Weekday
+		start, end int
+		location   string
+		wantErr    bool
+	}{
+		{raw: "Sat 02:00-04:00 UTC", days: []time.Weekday{time.Saturday}, start: 120, end: 240, location: "UTC"},
+		{raw: "mon-fri 22:00-02:00 America/New_York", days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, start: 1320, end: 120, location: "America/New_York"},
+		{raw: "Fri-Mon 00:00-06:00 UTC", days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}, start: 0, end: 360, location: "UTC"},
+		{raw: "Sat,Sun 01:30-03:00 UTC", days: []time.Weekday{time.Saturday, time.Sunday}, start: 90, end: 180, location: "UTC"},
+		{raw: "Sat", wantErr: true},
+		{raw: "Sat 02:00-04:00 UTC extra", wantErr: true},
+		{raw: "Someday 02:00-04:00", wantErr: true},
+		{raw: "Mon-Funday 02:00-04:00", wantErr: true},
+		{raw: "Sat 02:00", wantErr: true},
+		{raw: "Sat 2am-4am", wantErr: true},
+		{raw: "Sat 02:00-02:00", wantErr: true},
+		{raw: "Sat 02:00-04:00 Mars/Olympus_Mons", wantErr: true},
+	}
+	for _, tt := range tests {
+		w, err := parseWindow(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWindow(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(w.days) != len(tt.days) {
+			t.Errorf("parseWindow(%q) days = %v, want %v", tt.raw, w.days, tt.days)
+		}
+		for _, day := range tt.days {
+			if !w.days[day] {
+				t.Errorf("parseWindow(%q) does not include %s", tt.raw, day)
+			}
+		}
+		if w.start != tt.start || w.end != tt.end || w.location.String() != tt.location {
+			t.Errorf("parseWindow(%q) = %d-%d %s, want %d-%d %s", tt.raw, w.start, w.end, w.location, tt.start, tt.end, tt.location)
+		}
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	// 2024-01-06 is a Saturday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window   string
+		now      time.Time
+		contains bool
+		next     time.Time
+	}{
+		{window: "Sat 02:00-04:00 UTC", now: at(6, 3, 0), contains: true, next: at(13, 2, 0)},
+		{window: "Sat 02:00-04:00 UTC", now: at(6, 4, 0), contains: false, next: at(13, 2, 0)},
+		{window: "Sat 02:00-04:00 UTC", now: at(6, 1, 59), contains: false, next: at(6, 2, 0)},
+		{window: "Sat 02:00-04:00 UTC", now: at(3, 12, 0), contains: false, next: at(6, 2, 0)},
+		// Crossing midnight: Friday's window runs into Saturday.
+		{window: "Fri 22:00-02:00 UTC", now: at(5, 23, 0), contains: true, next: at(12, 22, 0)},
+		{window: "Fri 22:00-02:00 UTC", now: at(6, 1, 0), contains: true, next: at(12, 22, 0)},
+		{window: "Fri 22:00-02:00 UTC", now: at(6, 2, 0), contains: false, next: at(12, 22, 0)},
+		{window: "Fri 22:00-02:00 UTC", now: at(5, 1, 0), contains: false, next: at(5, 22, 0)},
+		// 02:00 in New York is 07:00 UTC in January.
+		{window: "Sat 02:00-04:00 America/New_York", now: at(6, 8, 0), contains: true, next: at(13, 7, 0)},
+		{window: "Sat 02:00-04:00 America/New_York", now: at(6, 3, 0), contains: false, next: at(6, 7, 0)},
+	}
+	for _, tt := range tests {
+		w, err := parseWindow(tt.window)
+		if err != nil {
+			t.Fatalf("parseWindow(%q): %v", tt.window, err)
+		}
+		if got := w.contains(tt.now); got != tt.contains {
+			t.Errorf("%q contains %s = %t, want %t", tt.window, tt.now, got, tt.contains)
+		}
+		if got := w.next(tt.now); !got.Equal(tt.next) {
+			t.Errorf("%q next after %s = %s, want %s", tt.window, tt.now, got.UTC(), tt.next)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"my-k8s-redeploy/pkg/restarter"
+)
+
+// completeWorkloads parses the KIND/NAME arguments of restart and plan,
+// which restart those workloads instead of the ones owning matching pods.
+func (o *options) completeWorkloads(cmd *cobra.Command, args []string) error {
+	o.workloads = nil
+	if len(args) == 0 {
+		return nil
+	}
+	if o.watch || o.watchSecret != "" {
+		return fmt.Errorf("workload arguments cannot be combined with --watch or --watch-secret")
+	}
+	if o.allNamespaces || len(o.namespaces) > 1 {
+		return fmt.Errorf("workload arguments are looked up in a single --namespace")
+	}
+	podFilters := []string{
+		"match", "selector", "field-selector", "helm-release", "image-match", "cel",
+		"node", "node-selector", "pvc", "storage-class",
+		"min-restarts", "last-state", "older-than", "memory-above", "cpu-above",
+	}
+	for _, name := range podFilters {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("workload arguments cannot be combined with --%s, they are restarted whatever their pods", name)
+		}
+	}
+	for _, arg := range args {
+		ref, err := restarter.ParseWorkloadRef(arg)
+		if err != nil {
+			return err
+		}
+		o.workloads = append(o.workloads, ref)
+	}
+	return nil
+}